@@ -0,0 +1,181 @@
+package chunker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+const testBlockSize = 4096
+
+func TestChunkerAlignment(t *testing.T) {
+	data := getRandom(23, 16*1024*1024+1000)
+
+	for _, opt := range []option{WithAlignment(testBlockSize), WithHybridAlignment(testBlockSize)} {
+		// MinSize and MaxSize are not aligned
+		chunks := standaloneChunks(t, data, WithBoundaries(10000, 300000), WithAverageBits(3), opt)
+
+		if len(chunks) < 50 {
+			t.Fatalf("too few chunks: %d", len(chunks))
+		}
+
+		for i, c := range chunks[:len(chunks)-1] {
+			if c.Start%testBlockSize != 0 || c.Length%testBlockSize != 0 {
+				t.Fatalf("chunk %d is not aligned: %d/%d", i, c.Start, c.Length)
+			}
+
+			if c.Length < 3*testBlockSize || c.Length > 73*testBlockSize {
+				t.Fatalf("chunk %d has wrong size %d", i, c.Length)
+			}
+		}
+	}
+}
+
+func TestChunkerAlignmentMaxSize(t *testing.T) {
+	data := getRandom(23, 4*1024*1024)
+
+	for _, test := range []struct {
+		min, max, align uint
+	}{
+		{512, 5000, testBlockSize},
+		{5000, 7000, testBlockSize},
+		{10000, 300000, testBlockSize},
+		{64 * 1024, 64 * 1024, 3000},
+	} {
+		for _, opt := range []option{WithAlignment(test.align), WithHybridAlignment(test.align)} {
+			opts := []option{WithBoundaries(test.min, test.max), WithAverageBits(12), opt}
+			for i, c := range standaloneChunks(t, data, opts...) {
+				if c.Length > test.max {
+					t.Fatalf("boundaries %d/%d, alignment %d: chunk %d is longer than the maximum: %d",
+						test.min, test.max, test.align, i, c.Length)
+				}
+			}
+		}
+	}
+}
+
+func TestChunkerAlignmentSmallMaxSize(t *testing.T) {
+	defer func() {
+		if err := recover(); err == nil {
+			t.Fatal("no panic for MaxSize smaller than the alignment")
+		}
+	}()
+
+	New(bytes.NewReader(nil), testPol, WithBoundaries(512, 1000), WithAlignment(testBlockSize))
+}
+
+func TestChunkerAlignmentCuts(t *testing.T) {
+	data := getRandom(23, 16*1024*1024)
+	opts := []option{WithBoundaries(16*1024, 1024*1024), WithAverageBits(15)}
+	plain := standaloneChunks(t, data, opts...)
+	aligned := standaloneChunks(t, data, append(opts, WithAlignment(testBlockSize))...)
+
+	// the first cut is rounded up to the next block
+	want := (plain[0].Length + testBlockSize - 1) / testBlockSize * testBlockSize
+	if aligned[0].Length != want || aligned[0].Cut != plain[0].Cut {
+		t.Fatalf("wrong first cut at %d, want %d", aligned[0].Length, want)
+	}
+
+	// the cuts are the same for a small buffer
+	small := standaloneChunks(t, data, append(opts, WithAlignment(testBlockSize), WithBuffer(make([]byte, 1000)))...)
+	if len(small) != len(aligned) {
+		t.Fatalf("wrong number of chunks for small buffer: want %d, got %d", len(aligned), len(small))
+	}
+
+	for i := range aligned {
+		if small[i].Start != aligned[i].Start || small[i].Length != aligned[i].Length {
+			t.Fatalf("chunk %d differs for small buffer", i)
+		}
+	}
+}
+
+// reflinkReuse returns the fraction of the bytes of data which can be
+// restored by cloning whole blocks of the chunks of old.
+func reflinkReuse(t *testing.T, old, data []byte, opts ...option) float64 {
+	offsets := make(map[[sha256.Size]byte]uint)
+	for _, c := range standaloneChunks(t, old, opts...) {
+		offsets[sha256.Sum256(c.Data)] = c.Start
+	}
+
+	var reused uint
+	for _, c := range standaloneChunks(t, data, opts...) {
+		off, ok := offsets[sha256.Sum256(c.Data)]
+		if !ok || (c.Start-off)%testBlockSize != 0 {
+			continue
+		}
+
+		// only whole blocks can be cloned
+		first := (c.Start + testBlockSize - 1) / testBlockSize * testBlockSize
+		last := (c.Start + c.Length) / testBlockSize * testBlockSize
+		if last > first {
+			reused += last - first
+		}
+	}
+
+	return float64(reused) / float64(len(data))
+}
+
+func TestChunkerAlignmentReuse(t *testing.T) {
+	rnd := rand.New(rand.NewSource(5))
+	old := getRandom(23, 32*1024*1024)
+	blocks := len(old) / testBlockSize
+
+	// overwrite random blocks
+	overwritten := append([]byte(nil), old...)
+	for i := 0; i < 100; i++ {
+		b := rnd.Intn(blocks)
+		rnd.Read(overwritten[b*testBlockSize : (b+1)*testBlockSize])
+	}
+
+	// move extents of blocks around
+	var moved []byte
+	for len(moved) < len(old) {
+		b := rnd.Intn(blocks - 64)
+		n := 1 + rnd.Intn(64)
+		moved = append(moved, old[b*testBlockSize:(b+n)*testBlockSize]...)
+	}
+
+	plain := []option{WithBoundaries(16*1024, 256*1024), WithAverageBits(15)}
+	aligned := append(plain, WithAlignment(testBlockSize))
+	hybrid := []option{WithBoundaries(16*1024, 256*1024), WithAverageBits(3), WithHybridAlignment(testBlockSize)}
+
+	for _, test := range []struct {
+		name string
+		data []byte
+	}{
+		{"overwritten blocks", overwritten},
+		{"moved extents", moved},
+	} {
+		p := reflinkReuse(t, old, test.data, plain...)
+		a := reflinkReuse(t, old, test.data, aligned...)
+		h := reflinkReuse(t, old, test.data, hybrid...)
+		t.Logf("%v: reuse plain %.3f, aligned %.3f, hybrid %.3f", test.name, p, a, h)
+
+		if a <= p || h <= p {
+			t.Errorf("%v: aligned cuts do not improve reuse: plain %.3f, aligned %.3f, hybrid %.3f",
+				test.name, p, a, h)
+		}
+	}
+}
+
+func BenchmarkChunkerHybridAlignment(b *testing.B) {
+	data := getRandom(23, 32*1024*1024)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ch := New(bytes.NewReader(data), testPol, WithAverageBits(8), WithHybridAlignment(testBlockSize))
+		for {
+			_, err := ch.Next(nil)
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
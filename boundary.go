@@ -0,0 +1,88 @@
+package chunker
+
+import "io"
+
+// BoundaryReader passes the data read from a reader through unchanged and
+// reports the chunk boundaries found in it. Only the data passed to Read is
+// processed, no chunk is buffered.
+type BoundaryReader struct {
+	rd   io.Reader
+	base *BaseChunker
+	fn   func(Chunk) error
+
+	start uint // start of the current chunk
+	pos   uint
+	done  bool
+	err   error // returned by fn
+}
+
+// NewBoundaryReader returns a BoundaryReader which reads from rd and calls fn
+// for each chunk found with polynomial pol, see NewBase for the options. The
+// chunks are passed without Data in order, fn is called for a chunk during the
+// Read which returns its last byte. The last chunk is reported when rd returns
+// io.EOF. An error returned by fn is returned by Read, the BoundaryReader is
+// failed afterwards: the rest of the data is not scanned and all subsequent
+// calls to Read return the same error.
+func NewBoundaryReader(rd io.Reader, pol Pol, fn func(Chunk) error, opts ...baseOption) *BoundaryReader {
+	return &BoundaryReader{
+		rd:   rd,
+		base: NewBase(pol, opts...),
+		fn:   fn,
+	}
+}
+
+// Read reads from the underlying reader and reports the chunks which end in
+// the data returned.
+func (r *BoundaryReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err := r.rd.Read(p)
+
+	for buf := p[:n]; len(buf) > 0; {
+		split, cut := r.base.NextSplitPoint(buf)
+		if split == -1 {
+			r.pos += uint(len(buf))
+			break
+		}
+
+		r.pos += uint(split)
+		buf = buf[split:]
+
+		flags := r.base.lastFlags()
+		if r.base.LastCutForced() {
+			flags |= ChunkForced
+		}
+
+		if ferr := r.report(cut, flags); ferr != nil {
+			return n, ferr
+		}
+	}
+
+	if err == io.EOF && !r.done {
+		r.done = true
+		if r.pos > r.start {
+			// somewhat meaningless as this is not a split point
+			if ferr := r.report(r.base.digest, r.base.pendingFlags()); ferr != nil {
+				return n, ferr
+			}
+		}
+	}
+
+	return n, err
+}
+
+// report passes the chunk which ends at the current position to fn.
+func (r *BoundaryReader) report(cut uint64, flags ChunkFlags) error {
+	chunk := Chunk{
+		Start:  r.start,
+		Length: r.pos - r.start,
+		Cut:    cut,
+		Flags:  flags,
+	}
+	r.start = r.pos
+
+	r.err = r.fn(chunk)
+	return r.err
+}
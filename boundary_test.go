@@ -0,0 +1,124 @@
+package chunker
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+)
+
+func TestBoundaryReader(t *testing.T) {
+	data := getRandom(23, 32*1024*1024)
+
+	for _, wrap := range []func(io.Reader) io.Reader{
+		func(rd io.Reader) io.Reader { return rd },
+		iotest.HalfReader,
+		iotest.DataErrReader,
+	} {
+		var chunks []Chunk
+		rd := NewBoundaryReader(wrap(bytes.NewReader(data)), testPol, func(c Chunk) error {
+			chunks = append(chunks, c)
+			return nil
+		})
+
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, rd); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Fatal("data was changed")
+		}
+
+		if len(chunks) != len(chunks1) {
+			t.Fatalf("wrong number of chunks: want %d, got %d", len(chunks1), len(chunks))
+		}
+
+		pos := uint(0)
+		for i, c := range chunks {
+			if c.Start != pos || c.Length != chunks1[i].Length || c.Cut != chunks1[i].CutFP || c.Data != nil {
+				t.Fatalf("wrong chunk %d: %d/%d/%016x", i, c.Start, c.Length, c.Cut)
+			}
+			pos += c.Length
+		}
+	}
+}
+
+func TestBoundaryReaderSmall(t *testing.T) {
+	data := getRandom(23, 1024*1024)
+	opts := []baseOption{WithBaseBoundaries(4*1024, 64*1024), WithBaseAverageBits(13)}
+
+	var chunks []Chunk
+	rd := NewBoundaryReader(iotest.OneByteReader(bytes.NewReader(data)), testPol, func(c Chunk) error {
+		chunks = append(chunks, c)
+		return nil
+	}, opts...)
+
+	if _, err := io.Copy(ioutil.Discard, rd); err != nil {
+		t.Fatal(err)
+	}
+
+	want := standaloneChunks(t, data, WithBoundaries(4*1024, 64*1024), WithAverageBits(13))
+	if len(chunks) != len(want) {
+		t.Fatalf("wrong number of chunks: want %d, got %d", len(want), len(chunks))
+	}
+
+	for i, c := range chunks {
+		w := want[i]
+		if c.Start != w.Start || c.Length != w.Length || c.Cut != w.Cut {
+			t.Fatalf("wrong chunk %d: want %d/%d/%016x, got %d/%d/%016x",
+				i, w.Start, w.Length, w.Cut, c.Start, c.Length, c.Cut)
+		}
+	}
+}
+
+func TestBoundaryReaderError(t *testing.T) {
+	data := getRandom(23, 8*1024*1024)
+	errIndex := errors.New("index failed")
+
+	rd := NewBoundaryReader(bytes.NewReader(data), testPol, func(c Chunk) error {
+		return errIndex
+	})
+
+	n, err := io.Copy(ioutil.Discard, rd)
+	if err != errIndex {
+		t.Fatalf("wrong error returned: %v", err)
+	}
+
+	if n == 0 || n == int64(len(data)) {
+		t.Fatalf("wrong number of bytes read before the error: %d", n)
+	}
+
+	// the reader stays failed
+	for i := 0; i < 3; i++ {
+		if n, err := rd.Read(make([]byte, 1024)); n != 0 || err != errIndex {
+			t.Fatalf("wrong result after the error: %d, %v", n, err)
+		}
+	}
+
+	// an empty reader yields no chunks
+	rd = NewBoundaryReader(bytes.NewReader(nil), testPol, func(c Chunk) error {
+		return errIndex
+	})
+
+	if _, err := io.Copy(ioutil.Discard, rd); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func BenchmarkBoundaryReader(b *testing.B) {
+	data := getRandom(23, 32*1024*1024)
+	buf := make([]byte, 32*1024)
+
+	b.ResetTimer()
+	b.SetBytes(int64(len(data)))
+
+	for i := 0; i < b.N; i++ {
+		rd := NewBoundaryReader(bytes.NewReader(data), testPol, func(c Chunk) error { return nil })
+		if _, err := io.CopyBuffer(ioutil.Discard, rd, buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
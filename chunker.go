@@ -1,8 +1,13 @@
 package chunker
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"math/bits"
 	"sync"
+	"time"
 )
 
 const (
@@ -25,14 +30,25 @@ type tables struct {
 	mod [256]Pol
 }
 
-// cache precomputed tables, these are read-only anyway
+// tableKey identifies the tables for a polynomial and window size.
+type tableKey struct {
+	pol    Pol
+	window int
+}
+
+// maxCachedTables is the number of tables kept in the cache, about 4KiB each.
+const maxCachedTables = 256
+
+// cache precomputed tables, these are read-only anyway. When the cache is
+// full, the oldest entry is dropped, order contains the keys by age.
 var cache struct {
-	entries map[Pol]tables
+	entries map[tableKey]*tables
+	order   []tableKey
 	sync.Mutex
 }
 
 func init() {
-	cache.entries = make(map[Pol]tables)
+	cache.entries = make(map[tableKey]*tables)
 }
 
 type chunkerState struct {
@@ -42,6 +58,20 @@ type chunkerState struct {
 
 	pre   uint // wait for this many bytes before start calculating an new chunk
 	count uint // used for max chunk size tracking
+
+	offset uint   // number of bytes processed, not reset at a cut
+	cuts   []uint // offsets of forced cuts, see CutAt
+	forced bool   // the last split point was a forced cut
+
+	// searching for a delimiter after a hash match, see WithDelimiter
+	seeking    bool
+	seekLeft   uint
+	seekDigest uint64
+	dmatch     int
+
+	// whether the chunk consists of a single repeated byte, see WithRepeatRuns
+	repeat       repeatState
+	lastRepeated bool
 }
 
 type chunkerConfig struct {
@@ -52,6 +82,17 @@ type chunkerConfig struct {
 	tables            tables
 	tablesInitialized bool
 	splitmask         uint64
+
+	delim     []byte
+	dfail     []int
+	lookahead uint
+
+	align       uint
+	alignHybrid bool
+
+	fixedSize uint
+
+	runs bool
 }
 
 // Chunker splits content with Rabin Fingerprints.
@@ -61,7 +102,21 @@ type BaseChunker struct {
 }
 
 func NewBase(pol Pol, opts ...baseOption) *BaseChunker {
-	c := &BaseChunker{
+	c := newBase(pol)
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.alignBoundaries()
+	c.checkAverageBits()
+	c.reset()
+	return c
+}
+
+// newBase returns a BaseChunker with the default configuration, which is not
+// initialized until reset is called.
+func newBase(pol Pol) *BaseChunker {
+	return &BaseChunker{
 		chunkerState: chunkerState{},
 		chunkerConfig: chunkerConfig{
 			pol:       pol,
@@ -70,13 +125,6 @@ func NewBase(pol Pol, opts ...baseOption) *BaseChunker {
 			splitmask: (1 << 20) - 1, // aim to create chunks of 20 bits or about 1MiB on average.
 		},
 	}
-
-	for _, opt := range opts {
-		opt(c)
-	}
-
-	c.reset()
-	return c
 }
 
 // Reset reinitializes the chunker with a new reader, polynomial, and options.
@@ -95,12 +143,48 @@ func (c *BaseChunker) reset() {
 	c.digest = 0
 	c.wpos = 0
 	c.count = 0
+	c.seeking = false
+	c.repeat = repeatState{}
 	c.digest = c.slide(c.digest, 1)
 
 	// do not start a new chunk unless at least MinSize bytes have been read
 	c.pre = c.MinSize - windowSize
 }
 
+// checkAverageBits panics if the split mask is not narrower than the digest.
+// Otherwise almost no digest matches it, and nearly all chunks are cut at
+// MaxSize.
+func (c *BaseChunker) checkAverageBits() {
+	if c.pol == 0 {
+		return
+	}
+
+	checkPolDegree(c.pol)
+	if n := bits.Len64(c.splitmask); n >= c.pol.Deg() {
+		panic(fmt.Sprintf("average bits %d not supported for a polynomial of degree %d, must be smaller than the degree",
+			n, c.pol.Deg()))
+	}
+}
+
+// alignBoundaries rounds MinSize up and MaxSize down to multiples of the
+// alignment, so that all chunk sizes are multiples of it. It panics if MaxSize
+// is smaller than the alignment.
+func (c *BaseChunker) alignBoundaries() {
+	if c.align <= 1 {
+		return
+	}
+
+	if c.MaxSize < c.align {
+		panic(fmt.Sprintf("maximum chunk size %d is smaller than the alignment %d", c.MaxSize, c.align))
+	}
+
+	c.MaxSize = c.MaxSize / c.align * c.align
+	c.MinSize = (c.MinSize + c.align - 1) / c.align * c.align
+	if c.MinSize > c.MaxSize {
+		c.MinSize = c.MaxSize
+	}
+}
+
 // fillTables calculates out_table and mod_table for optimization. This
 // implementation uses a cache in the global variable cache.
 func (c *BaseChunker) fillTables() {
@@ -109,16 +193,38 @@ func (c *BaseChunker) fillTables() {
 		return
 	}
 
+	c.tables = *polTables(c.pol)
 	c.tablesInitialized = true
+}
+
+// checkPolDegree panics if the chunker does not support the degree of pol.
+func checkPolDegree(pol Pol) {
+	if err := checkDegree(pol.Deg()); err != nil {
+		panic(err.Error())
+	}
+}
+
+// polTables returns the tables for pol and the chunker's window size, which
+// are computed on first use and cached afterwards.
+func polTables(pol Pol) *tables {
+	return windowTables(pol, windowSize)
+}
+
+// windowTables returns the tables for pol and the given window size, which
+// are computed on first use and cached afterwards.
+func windowTables(pol Pol, window int) *tables {
+	checkPolDegree(pol)
 
 	// test if the tables are cached for this polynomial
+	key := tableKey{pol: pol, window: window}
 	cache.Lock()
 	defer cache.Unlock()
-	if t, ok := cache.entries[c.pol]; ok {
-		c.tables = t
-		return
+	if t, ok := cache.entries[key]; ok {
+		return t
 	}
 
+	t := &tables{}
+
 	// calculate table for sliding out bytes. The byte to slide out is used as
 	// the index for the table, the value contains the following:
 	// out_table[b] = Hash(b || 0 ||        ...        || 0)
@@ -129,19 +235,16 @@ func (c *BaseChunker) fillTables() {
 	//  = H(b_0 + b_0 || b_1 + 0 || ... || b_w + 0)
 	//  = H(    0     || b_1 || ...     || b_w)
 	//
-	// Afterwards a new byte can be shifted in.
-	for b := 0; b < 256; b++ {
-		var h Pol
-
-		h = appendByte(h, byte(b), c.pol)
-		for i := 0; i < windowSize-1; i++ {
-			h = appendByte(h, 0, c.pol)
-		}
-		c.tables.out[b] = h
+	// Afterwards a new byte can be shifted in. Appending the zero bytes
+	// multiplies by x^(8*(windowsize-1)), which is computed only once.
+	b := newBarrett(pol)
+	shift := b.expMod(Pol(1<<8).Mod(pol), uint64(window-1))
+	for i := 0; i < 256; i++ {
+		t.out[i] = b.mulMod(Pol(i).Mod(pol), shift)
 	}
 
 	// calculate table for reduction mod Polynomial
-	k := c.pol.Deg()
+	k := pol.Deg()
 	for b := 0; b < 256; b++ {
 		// mod_table[b] = A | B, where A = (b(x) * x^k mod pol) and  B = b(x) * x^k
 		//
@@ -150,15 +253,80 @@ func (c *BaseChunker) fillTables() {
 		// two parts: Part A contains the result of the modulus operation, part
 		// B is used to cancel out the 8 top bits so that one XOR operation is
 		// enough to reduce modulo Polynomial
-		c.tables.mod[b] = Pol(uint64(b)<<uint(k)).Mod(c.pol) | (Pol(b) << uint(k))
+		t.mod[b] = Pol(uint64(b)<<uint(k)).Mod(pol) | (Pol(b) << uint(k))
 	}
 
-	cache.entries[c.pol] = c.tables
+	if len(cache.order) == maxCachedTables {
+		delete(cache.entries, cache.order[0])
+		cache.order = append(cache.order[:0], cache.order[1:]...)
+	}
+
+	cache.entries[key] = t
+	cache.order = append(cache.order, key)
+	return t
 }
 
 // NextSplitPoint returns the index before which the buf should be split
 // Returns -1 if no split point was found yet.
 func (c *BaseChunker) NextSplitPoint(buf []byte) (int, uint64) {
+	// a forced cut in buf ends the chunk early
+	forced := c.nextForcedCut(buf)
+	if forced >= 0 {
+		buf = buf[:forced]
+	}
+
+	c.forced = false
+	repeat := c.repeat // reset at a cut, so it is updated afterwards
+
+	var split int
+	var cut uint64
+	if c.runs && c.fixedSize == 0 {
+		split, cut = c.nextRunSplitPoint(buf)
+	} else {
+		split, cut = c.nextSplitPoint(buf)
+	}
+
+	if split != -1 {
+		c.offset += uint(split)
+		c.endRepeat(repeat, buf[:split])
+		return split, cut
+	}
+	c.offset += uint(len(buf))
+
+	if forced >= 0 {
+		c.cuts = c.cuts[1:]
+		c.forced = true
+		c.endRepeat(repeat, buf)
+		cut = c.digest
+		c.reset()
+		return forced, cut
+	}
+
+	if c.runs {
+		repeat.update(buf)
+		c.repeat = repeat
+	}
+
+	return -1, 0
+}
+
+// nextSplitPoint returns the next content-defined split point in buf.
+func (c *BaseChunker) nextSplitPoint(buf []byte) (int, uint64) {
+	if c.fixedSize > 0 {
+		return c.nextFixedSplitPoint(buf)
+	}
+
+	if c.seeking {
+		n := c.seekCut(buf)
+		if n == -1 {
+			return -1, 0
+		}
+
+		digest := c.seekDigest
+		c.reset()
+		return n, digest
+	}
+
 	if !c.tablesInitialized {
 		panic("tables for polynomial computation not initialized")
 	}
@@ -209,6 +377,40 @@ func (c *BaseChunker) NextSplitPoint(buf []byte) (int, uint64) {
 			if add < minSize {
 				continue
 			}
+
+			// move the cut forward to an aligned position or behind the
+			// next delimiter
+			var seek uint
+			switch {
+			case add >= maxSize:
+			case c.align > 1:
+				if add%c.align != 0 {
+					if c.alignHybrid {
+						continue
+					}
+					seek = c.align - add%c.align
+				}
+			case c.delim != nil:
+				seek = c.lookahead
+			}
+
+			if seek > 0 {
+				c.count = add
+				c.digest = digest
+				c.seeking = true
+				c.seekLeft = seek
+				c.seekDigest = digest
+				c.dmatch = 0
+
+				n := c.seekCut(buf[i+1:])
+				if n == -1 {
+					return -1, 0
+				}
+
+				c.reset()
+				return idx + i + 1 + n, digest
+			}
+
 			c.reset()
 			return idx + i + 1, digest
 		}
@@ -239,22 +441,38 @@ func (c *BaseChunker) slide(digest uint64, b byte) (newDigest uint64) {
 	return digest
 }
 
-func appendByte(hash Pol, b byte, pol Pol) Pol {
-	hash <<= 8
-	hash |= Pol(b)
-
-	return hash.Mod(pol)
-}
-
 // Chunk is one content-dependent chunk of bytes whose end was cut when the
 // Rabin Fingerprint had the value stored in Cut.
 type Chunk struct {
 	Start  uint
 	Length uint
 	Cut    uint64
-	Data   []byte
+
+	// Data holds the content of the chunk. For a mapped file chunked by a
+	// FileChunker it points into the mapping and must not be accessed after
+	// FileChunker.Close, see ChunkFile.
+	Data  []byte
+	Flags ChunkFlags
 }
 
+// ChunkFlags describe why a Chunk was cut other than by its content.
+type ChunkFlags uint8
+
+const (
+	// ChunkFlushed is set for chunks which were cut because the data was
+	// pending for longer than the maximum latency, see WithMaxLatency.
+	ChunkFlushed ChunkFlags = 1 << iota
+
+	// ChunkForced is set for chunks which end at a forced cut, see CutAt and
+	// CutHere.
+	ChunkForced
+
+	// ChunkRepeated is set for chunks which consist of a single repeated
+	// byte, e.g. zeros, see WithRepeatRuns. Such a chunk is identified by its
+	// first byte and its length, so hashing it can be avoided.
+	ChunkRepeated
+)
+
 type chunkerBuffer struct {
 	buf  []byte
 	bpos uint
@@ -263,6 +481,43 @@ type chunkerBuffer struct {
 
 	rd     io.Reader
 	closed bool
+
+	// readDeadline is the deadline set with SetReadDeadline, it is restored
+	// after NextContext has interrupted a read
+	readDeadline time.Time
+
+	// follow is set in follow mode, see WithFollow
+	follow bool
+
+	// sparse is set if holes in files are skipped, see WithSparse
+	sparse bool
+
+	// streaming mode, see WithStreaming and WithMaxLatency
+	streaming  bool
+	maxLatency time.Duration
+	reading    bool
+	result     chan readResult
+	bufTime    time.Time
+	chunkSince time.Time
+
+	// fixed-size chunks, see WithFixedTail
+	fixedTail FixedTail
+	held      Chunk
+	hasHeld   bool
+	scratch   []byte
+
+	// partial holds the data of a chunk interrupted by an error or a
+	// cancelled context, it started at partialStart
+	partial      []byte
+	partialStart uint
+
+	// the cut and flags of the chunk which ended after the last piece
+	// returned by scan
+	endCut   uint64
+	endFlags ChunkFlags
+
+	// current is the reader of the chunk returned by NextReader
+	current *chunkReader
 }
 
 // Chunker splits content with Rabin Fingerprints.
@@ -275,7 +530,7 @@ type Chunker struct {
 // Chunker behavior can be customized by passing options, see With* functions.
 func New(rd io.Reader, pol Pol, opts ...option) *Chunker {
 	c := &Chunker{
-		BaseChunker: *NewBase(pol),
+		BaseChunker: *newBase(pol),
 		chunkerBuffer: chunkerBuffer{
 			buf: make([]byte, chunkerBufSize),
 			rd:  rd,
@@ -290,6 +545,14 @@ func New(rd io.Reader, pol Pol, opts ...option) *Chunker {
 		c.buf = make([]byte, chunkerBufSize)
 	}
 
+	c.alignBoundaries()
+	c.checkAverageBits()
+
+	if c.sparse {
+		c.runs = true
+		c.rd = newSparseReader(c.rd)
+	}
+
 	c.reset()
 	return c
 }
@@ -309,78 +572,225 @@ func NewWithBoundaries(rd io.Reader, pol Pol, min, max uint) *Chunker {
 // Deprecated: SetAverageBits uses should be replaced by NewBase(rd, pol, WithAverageBits(averageBits)).
 func (c *Chunker) SetAverageBits(averageBits int) {
 	c.splitmask = (1 << uint64(averageBits)) - 1
+	c.checkAverageBits()
 }
 
 // Reset reinitializes the chunker with a new reader, polynomial, and options.
 func (c *Chunker) Reset(rd io.Reader, pol Pol, opts ...option) {
-	opts = append([]option{WithBuffer(c.buf)}, opts...)
+	// the buffer is still in use while a read is pending in streaming mode
+	if !c.reading {
+		opts = append([]option{WithBuffer(c.buf)}, opts...)
+	}
 	*c = *New(rd, pol, opts...)
 }
 
+// SetReader replaces the reader without changing the state of the chunker,
+// e.g. to resume reading after an error. The new reader must return the data
+// following the last byte returned by the previous reader.
+func (c *Chunker) SetReader(rd io.Reader) {
+	if c.sparse {
+		rd = newSparseReader(rd)
+	}
+	c.rd = rd
+	c.readDeadline = time.Time{}
+}
+
+// ErrNoProgress is returned by Next in follow mode when the reader has no
+// more data available, see WithFollow.
+var ErrNoProgress = errors.New("no new data available")
+
+// Finish ends follow mode, see WithFollow. Afterwards, Next treats io.EOF
+// returned by the reader as the end of the data and returns the pending data
+// as the last chunk.
+func (c *Chunker) Finish() {
+	c.follow = false
+}
+
 // Deprecated: ResetWithBoundaries uses should be replaced by Reset(rd, pol, WithBoundaries(min, max)).
 func (c *Chunker) ResetWithBoundaries(rd io.Reader, pol Pol, min, max uint) {
 	c.Reset(rd, pol, WithBoundaries(min, max))
 }
 
 // Next returns the position and length of the next chunk of data. If an error
-// occurs while reading, the error is returned. Afterwards, the state of the
-// current chunk is undefined. When the last chunk has been returned, all
-// subsequent calls yield an io.EOF error.
+// occurs while reading, the error is returned. The bytes of the current chunk
+// and the rolling state are kept, so Next can be called again after a
+// temporary error, or after the reader has been replaced with SetReader, and
+// continues as if no error had occurred. When the last chunk has been
+// returned, all subsequent calls yield an io.EOF error.
+//
+// Only io.EOF marks the end of the data. If the reader itself returns
+// io.ErrUnexpectedEOF, e.g. for a truncated stream, the error is returned
+// once no more bytes are read along with it.
 func (c *Chunker) Next(data []byte) (Chunk, error) {
+	return c.nextChunk(nil, data)
+}
+
+// next implements Next and NextContext, ctx is nil for the former.
+func (c *Chunker) next(ctx context.Context, data []byte) (Chunk, error) {
 	data = data[:0]
 	start := c.pos
+
+	// continue a chunk interrupted by an error, its data is collected in
+	// partial until the chunk ends, so that it is not copied again on every
+	// interruption, e.g. while polling in follow mode
+	var dst []byte
+	resumed := c.partial != nil
+	if resumed {
+		dst = data
+		data = c.partial
+		start = c.partialStart
+		c.partial = nil
+	}
+
 	for {
-		if c.bpos >= c.bmax {
-			n, err := io.ReadFull(c.rd, c.buf)
+		piece, end, err := c.scan(ctx, len(data) > 0)
+		if err != nil {
+			if resumed {
+				c.partial = data
+				c.partialStart = start
+			} else {
+				c.suspend(start, data)
+			}
+			return Chunk{}, err
+		}
 
-			if err == io.ErrUnexpectedEOF {
-				err = nil
+		data = append(data, piece...)
+		if end {
+			if resumed {
+				data = append(dst, data...)
 			}
 
-			// io.ReadFull only returns io.EOF when no bytes could be read. If
-			// this is the case and we're in this branch, there are no more
-			// bytes to buffer, so this was the last chunk. If a different
-			// error has occurred, return that error and abandon the current
-			// chunk.
-			if err == io.EOF && !c.closed {
-				c.closed = true
-
-				// return current chunk, if any bytes have been processed
-				if len(data) > 0 {
-					return Chunk{
-						Start:  start,
-						Length: uint(len(data)),
-						// somewhat meaningless as this is not a split point
-						Cut:  c.digest,
-						Data: data,
-					}, nil
-				}
+			return Chunk{
+				Start:  start,
+				Length: uint(len(data)),
+				Cut:    c.endCut,
+				Data:   data,
+				Flags:  c.endFlags,
+			}, nil
+		}
+	}
+}
+
+// scan returns the next piece of the current chunk, pending is true if the
+// chunk already contains data. The piece points into the buffer and is only
+// valid until the next call. If end is true, the chunk ends after the piece,
+// its cut and flags are stored in endCut and endFlags. The current chunk is
+// kept if an error is returned, io.EOF is only returned if it is empty.
+func (c *Chunker) scan(ctx context.Context, pending bool) (piece []byte, end bool, err error) {
+	if ctx != nil && ctx.Err() != nil {
+		return nil, false, ctx.Err()
+	}
+
+	// a forced cut at the end of the data processed so far
+	if c.bpos >= c.bmax && c.cutPending() {
+		_, c.endCut = c.NextSplitPoint(nil)
+		c.endFlags = ChunkForced | c.lastFlags()
+		c.chunkSince = time.Time{}
+		return nil, true, nil
+	}
+
+	if c.bpos >= c.bmax {
+		var n int
+		switch {
+		case c.streaming:
+			n, err = c.readStream(ctx)
+			if err == errFlush {
+				c.endCut = c.digest
+				c.endFlags = ChunkFlushed | c.pendingFlags()
+				c.chunkSince = time.Time{}
+				c.reset()
+				return nil, true, nil
 			}
 
-			if err != nil {
-				return Chunk{}, err
+			// process the data before returning io.EOF
+			if n > 0 && err == io.EOF {
+				err = nil
 			}
+		case ctx == nil:
+			n, err = io.ReadFull(c.rd, c.buf)
+		default:
+			n, err = c.readContext(ctx)
+		}
 
+		// io.ReadFull returns io.ErrUnexpectedEOF when the data ends
+		// within the buffer, the error from the reader is returned if no
+		// data could be read
+		if err == io.ErrUnexpectedEOF && n > 0 {
+			err = nil
+		}
+
+		// keep the bytes read so far, so that the next call continues after
+		// the error
+		if err != nil && err != io.EOF {
 			c.bpos = 0
 			c.bmax = uint(n)
+			return nil, false, err
 		}
 
-		split, cut := c.NextSplitPoint(c.buf[c.bpos:c.bmax])
-		if split == -1 {
-			data = append(data, c.buf[c.bpos:c.bmax]...)
-			c.pos += c.bmax - c.bpos
-			c.bpos = c.bmax
-		} else {
-			data = append(data, c.buf[c.bpos:c.bpos+uint(split)]...)
-			c.bpos += uint(split)
-			c.pos += uint(split)
+		// in follow mode, io.EOF only means that no data is available yet
+		if err == io.EOF && c.follow {
+			c.bpos = 0
+			c.bmax = 0
+			return nil, false, ErrNoProgress
+		}
 
-			return Chunk{
-				Start:  start,
-				Length: uint(len(data)),
-				Cut:    cut,
-				Data:   data,
-			}, nil
+		// io.ReadFull only returns io.EOF when no bytes could be read. If
+		// this is the case and we're in this branch, there are no more
+		// bytes to buffer, so this was the last chunk.
+		if err == io.EOF && !c.closed {
+			c.closed = true
+
+			// return current chunk, if any bytes have been processed
+			if pending {
+				// somewhat meaningless as this is not a split point
+				c.endCut = c.digest
+				c.endFlags = c.pendingFlags()
+				return nil, true, nil
+			}
+		}
+
+		if err != nil {
+			return nil, false, err
 		}
+
+		c.bpos = 0
+		c.bmax = uint(n)
+	}
+
+	if c.maxLatency > 0 && c.chunkSince.IsZero() && c.bpos < c.bmax {
+		c.chunkSince = c.bufTime
+	}
+
+	split, cut := c.NextSplitPoint(c.buf[c.bpos:c.bmax])
+	if split == -1 {
+		piece = c.buf[c.bpos:c.bmax]
+		c.pos += c.bmax - c.bpos
+		c.bpos = c.bmax
+		return piece, false, nil
 	}
+
+	piece = c.buf[c.bpos : c.bpos+uint(split)]
+	c.bpos += uint(split)
+	c.pos += uint(split)
+	c.chunkSince = time.Time{}
+
+	c.endCut = cut
+	c.endFlags = c.lastFlags()
+	if c.forced {
+		c.endFlags |= ChunkForced
+	}
+
+	return piece, true, nil
+}
+
+// suspend saves the data of the current chunk which started at start, so that
+// the next call to Next continues with it. The data is copied, as it is stored
+// in the buffer passed to Next.
+func (c *Chunker) suspend(start uint, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	c.partial = append([]byte(nil), data...)
+	c.partialStart = start
 }
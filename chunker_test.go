@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"io"
 	"math/rand"
 	"reflect"
@@ -378,3 +379,504 @@ func BenchmarkNewChunker(b *testing.B) {
 		New(bytes.NewBuffer(nil), p)
 	}
 }
+
+func TestFixedChunker(t *testing.T) {
+	buf := getRandom(23, 10*1024*1024+1000)
+
+	for _, bufSize := range []int{1000, chunkerBufSize} {
+		ch := NewFixed(bytes.NewReader(buf), 1024*1024, WithBuffer(make([]byte, bufSize)))
+		chunks := standaloneChunksFrom(t, ch)
+
+		if len(chunks) != 11 {
+			t.Fatalf("wrong number of chunks: %d", len(chunks))
+		}
+
+		for i, c := range chunks {
+			want := uint(1024 * 1024)
+			if i == len(chunks)-1 {
+				want = 1000
+			}
+
+			if c.Start != uint(i)*1024*1024 || c.Length != want || !bytes.Equal(c.Data, buf[c.Start:c.Start+c.Length]) {
+				t.Fatalf("wrong chunk %d: %d/%d", i, c.Start, c.Length)
+			}
+		}
+	}
+}
+
+func TestFixedChunkerTail(t *testing.T) {
+	for _, test := range []struct {
+		size    int
+		lengths []uint
+	}{
+		{0, nil},
+		{10, []uint{10}},
+		{100, []uint{100}},
+		{101, []uint{101}},
+		{200, []uint{100, 100}},
+		{250, []uint{100, 150}},
+		{1234, []uint{100, 100, 100, 100, 100, 100, 100, 100, 100, 100, 100, 134}},
+	} {
+		buf := getRandom(23, 2000)[:test.size]
+		ch := NewFixed(bytes.NewReader(buf), 100, WithFixedTail(TailMerge), WithBuffer(make([]byte, 64)))
+		chunks := standaloneChunksFrom(t, ch)
+
+		if len(chunks) != len(test.lengths) {
+			t.Fatalf("size %d: wrong number of chunks: want %d, got %d", test.size, len(test.lengths), len(chunks))
+		}
+
+		pos := uint(0)
+		for i, c := range chunks {
+			if c.Start != pos || c.Length != test.lengths[i] || !bytes.Equal(c.Data, buf[pos:pos+c.Length]) {
+				t.Fatalf("size %d: wrong chunk %d: %d/%d", test.size, i, c.Start, c.Length)
+			}
+			pos += c.Length
+		}
+	}
+}
+
+func TestFixedChunkerZeroSize(t *testing.T) {
+	defer func() {
+		if err := recover(); err != "size of fixed-size chunks must be positive" {
+			t.Fatalf("wrong panic for size zero: %v", err)
+		}
+	}()
+
+	NewFixed(bytes.NewReader(nil), 0)
+}
+
+// reuse returns the fraction of the bytes of the chunks of data which are
+// also chunks of old.
+func reuse(t *testing.T, old, data []byte, newChunker func(io.Reader) *Chunker) float64 {
+	seen := make(map[string]bool)
+	for _, c := range standaloneChunksFrom(t, newChunker(bytes.NewReader(old))) {
+		seen[string(hashData(c.Data))] = true
+	}
+
+	var reused uint
+	for _, c := range standaloneChunksFrom(t, newChunker(bytes.NewReader(data))) {
+		if seen[string(hashData(c.Data))] {
+			reused += c.Length
+		}
+	}
+
+	return float64(reused) / float64(len(data))
+}
+
+func TestFixedChunkerDedup(t *testing.T) {
+	old := getRandom(23, 32*1024*1024)
+
+	// insert a few bytes at some positions
+	var data []byte
+	last := 0
+	for _, pos := range []int{0, 5 * 1024 * 1024, 17 * 1024 * 1024} {
+		data = append(data, old[last:pos]...)
+		data = append(data, "inserted"...)
+		last = pos
+	}
+	data = append(data, old[last:]...)
+
+	rabin := reuse(t, old, data, func(rd io.Reader) *Chunker {
+		return New(rd, testPol, WithAverageBits(16), WithBoundaries(32*1024, 1024*1024))
+	})
+	fixed := reuse(t, old, data, func(rd io.Reader) *Chunker {
+		return NewFixed(rd, 64*1024)
+	})
+	t.Logf("reuse after insertions: rabin %.3f, fixed %.3f", rabin, fixed)
+
+	if rabin < 0.9 || fixed > 0.1 {
+		t.Fatalf("unexpected reuse: rabin %.3f, fixed %.3f", rabin, fixed)
+	}
+}
+
+func benchmarkFixedChunker(b *testing.B, size uint) {
+	data := getRandom(23, 32*1024*1024)
+	buf := make([]byte, size)
+
+	b.ResetTimer()
+	b.SetBytes(int64(len(data)))
+
+	for i := 0; i < b.N; i++ {
+		ch := NewFixed(bytes.NewReader(data), size)
+		for {
+			_, err := ch.Next(buf)
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkFixedChunker(b *testing.B) {
+	benchmarkFixedChunker(b, 1024*1024)
+}
+
+func BenchmarkFixedChunkerSmall(b *testing.B) {
+	benchmarkFixedChunker(b, 4096)
+}
+
+func TestChunkerPolynomialDegrees(t *testing.T) {
+	buf := getRandom(23, 32*1024*1024)
+	src := rand.New(rand.NewSource(42))
+
+	for _, deg := range []int{31, 47, 48, 53} {
+		pol, err := DerivePolynomialDegree(src, deg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pol.Deg() != deg || !pol.Irreducible() {
+			t.Fatalf("polynomial %v is not irreducible of degree %d", pol, deg)
+		}
+
+		const averageBits = 16
+		min, max := uint(16*1024), uint(8*1024*1024)
+		ch := New(bytes.NewReader(buf), pol, WithAverageBits(averageBits), WithBoundaries(min, max))
+
+		var chunks []Chunk
+		for {
+			c, err := ch.Next(nil)
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			chunks = append(chunks, c)
+		}
+
+		for _, c := range chunks[:len(chunks)-1] {
+			if c.Cut&(1<<averageBits-1) != 0 {
+				t.Fatalf("degree %d: cut %016x does not match the split mask", deg, c.Cut)
+			}
+
+			if c.Cut>>uint(deg) != 0 {
+				t.Fatalf("degree %d: cut %016x has more than %d bits", deg, c.Cut, deg)
+			}
+		}
+
+		// the average chunk size is the minimal size plus 2^averageBits
+		avg := float64(len(buf)) / float64(len(chunks))
+		want := float64(min + 1<<averageBits)
+		if avg < 0.85*want || avg > 1.15*want {
+			t.Errorf("degree %d: average chunk size %.0f, expected about %.0f", deg, avg, want)
+		}
+	}
+}
+
+func TestChunkerUnsupportedDegree(t *testing.T) {
+	for _, deg := range []int{5, 54, 60} {
+		_, err := DerivePolynomialDegree(bytes.NewReader(make([]byte, 64)), deg)
+		if err == nil {
+			t.Errorf("degree %d not rejected", deg)
+		}
+
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("chunker accepted polynomial of degree %d", deg)
+				}
+			}()
+
+			New(bytes.NewReader(nil), Pol(1<<uint(deg)|1))
+		}()
+	}
+}
+
+func TestChunkerAverageBitsDegree(t *testing.T) {
+	pol, err := DerivePolynomialDegree(rand.New(rand.NewSource(42)), 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// fewer average bits than the degree are accepted
+	New(bytes.NewReader(nil), pol, WithAverageBits(12))
+	NewBase(pol, WithBaseAverageBits(15))
+
+	for _, fn := range []func(){
+		func() { New(bytes.NewReader(nil), pol) },
+		func() { New(bytes.NewReader(nil), pol, WithAverageBits(16)) },
+		func() { NewBase(pol) },
+		func() { NewBase(pol, WithBaseAverageBits(16)) },
+		func() { New(bytes.NewReader(nil), pol, WithAverageBits(12)).SetAverageBits(20) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("split mask wider than the degree accepted")
+				}
+			}()
+
+			fn()
+		}()
+	}
+}
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "temporary error" }
+func (temporaryError) Temporary() bool { return true }
+
+// flakyReader returns an error on every nth read, half of the errors are
+// returned together with data.
+type flakyReader struct {
+	rd    io.Reader
+	n     int
+	reads int
+}
+
+func (r *flakyReader) Read(p []byte) (int, error) {
+	r.reads++
+	if r.reads%r.n != 0 {
+		return r.rd.Read(p)
+	}
+
+	if r.reads%(2*r.n) == 0 && len(p) > 10 {
+		n, err := r.rd.Read(p[:len(p)/3])
+		if err != nil {
+			return n, err
+		}
+		return n, temporaryError{}
+	}
+
+	return 0, temporaryError{}
+}
+
+func TestChunkerReadErrors(t *testing.T) {
+	buf := getRandom(23, 32*1024*1024)
+	ch := New(&flakyReader{rd: bytes.NewReader(buf), n: 3}, testPol)
+
+	var chunks []Chunk
+	failures := 0
+	for {
+		c, err := ch.Next(nil)
+		if err == io.EOF {
+			break
+		}
+
+		if _, ok := err.(temporaryError); ok {
+			failures++
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		chunks = append(chunks, c)
+	}
+
+	if failures == 0 {
+		t.Fatal("no errors were returned by the reader")
+	}
+
+	compareChunks(t, chunks, chunks1)
+}
+
+// failingReader returns an error after limit bytes.
+type failingReader struct {
+	data  []byte
+	limit int
+	pos   int
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.pos >= len(r.data) {
+		return 0, io.EOF
+	}
+
+	if r.pos >= r.limit {
+		return 0, errors.New("connection lost")
+	}
+
+	if len(p) > r.limit-r.pos {
+		p = p[:r.limit-r.pos]
+	}
+
+	n := copy(p, r.data[r.pos:])
+	r.pos += n
+	return n, nil
+}
+
+func TestChunkerSetReader(t *testing.T) {
+	buf := getRandom(23, 32*1024*1024)
+	rd := &failingReader{data: buf, limit: 5*1024*1024 + 123}
+	ch := New(rd, testPol)
+
+	var chunks []Chunk
+	for {
+		c, err := ch.Next(nil)
+		if err == io.EOF {
+			break
+		}
+
+		// resume reading at the position where the connection was lost
+		if err != nil {
+			if rd.limit == len(buf) {
+				t.Fatal(err)
+			}
+
+			rd = &failingReader{data: buf, limit: rd.limit + 7*1024*1024, pos: rd.pos}
+			if rd.limit > len(buf) {
+				rd.limit = len(buf)
+			}
+			ch.SetReader(rd)
+			continue
+		}
+
+		chunks = append(chunks, c)
+	}
+
+	compareChunks(t, chunks, chunks1)
+}
+
+// growingReader returns the data appended so far and io.EOF afterwards.
+type growingReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *growingReader) Read(p []byte) (int, error) {
+	if r.pos == len(r.data) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, r.data[r.pos:])
+	r.pos += n
+	return n, nil
+}
+
+func TestChunkerFollow(t *testing.T) {
+	buf := getRandom(23, 32*1024*1024)
+	rd := &growingReader{}
+	ch := New(rd, testPol, WithFollow())
+
+	var chunks []Chunk
+	next := func() error {
+		for {
+			c, err := ch.Next(nil)
+			if err != nil {
+				return err
+			}
+			chunks = append(chunks, c)
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(5))
+	for len(rd.data) < len(buf) {
+		n := len(rd.data) + rnd.Intn(3*1024*1024)
+		if n > len(buf) {
+			n = len(buf)
+		}
+		rd.data = buf[:n]
+
+		if err := next(); err != ErrNoProgress {
+			t.Fatalf("wrong error returned: %v", err)
+		}
+	}
+
+	// the last chunk is kept pending until Finish is called
+	if len(chunks) != len(chunks1)-1 {
+		t.Fatalf("wrong number of chunks before Finish: want %d, got %d", len(chunks1)-1, len(chunks))
+	}
+
+	ch.Finish()
+	if err := next(); err != io.EOF {
+		t.Fatalf("wrong error returned: %v", err)
+	}
+
+	compareChunks(t, chunks, chunks1)
+}
+
+func TestChunkerFollowPoll(t *testing.T) {
+	buf := getRandom(23, 4*1024*1024)
+	rd := &growingReader{data: buf[:3*1024*1024]}
+	ch := New(rd, testPol, WithFollow(), WithBoundaries(512*1024, 8*1024*1024))
+
+	var chunks []Chunk
+	for {
+		c, err := ch.Next(nil)
+		if err == ErrNoProgress {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, c)
+	}
+
+	// polling without new data does not copy the pending chunk
+	data := make([]byte, 0, 8*1024*1024)
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := ch.Next(data); err != ErrNoProgress {
+			t.Fatalf("wrong error returned: %v", err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("polling allocated %v times", allocs)
+	}
+
+	rd.data = buf
+	ch.Finish()
+	for {
+		c, err := ch.Next(nil)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, c)
+	}
+
+	want := standaloneChunks(t, buf, WithBoundaries(512*1024, 8*1024*1024))
+	if len(chunks) != len(want) {
+		t.Fatalf("wrong number of chunks: want %d, got %d", len(want), len(chunks))
+	}
+
+	for i, c := range chunks {
+		w := want[i]
+		if c.Start != w.Start || c.Length != w.Length || c.Cut != w.Cut || !bytes.Equal(c.Data, w.Data) {
+			t.Fatalf("wrong chunk %d: want %d/%d/%016x, got %d/%d/%016x",
+				i, w.Start, w.Length, w.Cut, c.Start, c.Length, c.Cut)
+		}
+	}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read(p []byte) (int, error) { return 0, r.err }
+
+func TestChunkerReaderUnexpectedEOF(t *testing.T) {
+	ch := New(errReader{io.ErrUnexpectedEOF}, testPol)
+	_, err := ch.Next(nil)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("wrong error returned: %v", err)
+	}
+
+	// the data read along with the error is kept
+	data := getRandom(23, 1024*1024)
+	rd := io.MultiReader(bytes.NewReader(data), errReader{io.ErrUnexpectedEOF})
+	ch = New(rd, testPol, WithBuffer(make([]byte, 1000*1000)))
+	if _, err := ch.Next(nil); err != io.ErrUnexpectedEOF {
+		t.Fatalf("wrong error returned: %v", err)
+	}
+
+	ch.SetReader(bytes.NewReader(nil))
+	c, err := ch.Next(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Start != 0 || !bytes.Equal(c.Data, data) {
+		t.Fatalf("wrong chunk returned: %d/%d", c.Start, c.Length)
+	}
+}
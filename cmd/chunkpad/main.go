@@ -0,0 +1,94 @@
+// Command chunkpad reports the storage overhead of padding the chunks of
+// the given files (or stdin) with a padding policy.
+//
+// Usage:
+//
+//	chunkpad [-pol 0x3da3358b4dc173] [-bits 4 | -key hex -percent 5] [file ...]
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/restic/chunker"
+)
+
+func main() {
+	polString := flag.String("pol", "0x3da3358b4dc173", "polynomial used for chunking")
+	bits := flag.Uint("bits", 4, "significant bits of the padded length for exponential padding")
+	key := flag.String("key", "", "hex `key` for keyed random padding (replaces exponential padding)")
+	percent := flag.Uint("percent", 5, "maximal padding in percent for keyed random padding")
+	flag.Parse()
+
+	n, err := strconv.ParseUint(*polString, 0, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid polynomial: %v\n", err)
+		os.Exit(2)
+	}
+	pol := chunker.Pol(n)
+
+	// the chunker supports degrees up to 53, the degree must be larger than
+	// the default of 20 average bits
+	if d := pol.Deg(); d <= 20 || d > 53 {
+		fmt.Fprintf(os.Stderr, "invalid polynomial: degree %d not supported, must be between 21 and 53\n", d)
+		os.Exit(2)
+	}
+
+	if !pol.Irreducible() {
+		fmt.Fprintf(os.Stderr, "invalid polynomial: %v is not irreducible\n", pol)
+		os.Exit(2)
+	}
+
+	var p chunker.Padding = chunker.ExponentialPadding{Bits: *bits}
+	if *key != "" {
+		k, err := hex.DecodeString(*key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid key: %v\n", err)
+			os.Exit(2)
+		}
+		p = chunker.KeyedPadding{Key: k, MaxPercent: *percent}
+	}
+
+	var total chunker.PaddingStats
+	measure := func(name string, rd io.Reader) {
+		stats, err := chunker.MeasurePadding(chunker.New(rd, pol), p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", name, err)
+			os.Exit(1)
+		}
+
+		report(name, stats)
+		total.Chunks += stats.Chunks
+		total.Bytes += stats.Bytes
+		total.PaddedBytes += stats.PaddedBytes
+	}
+
+	if flag.NArg() == 0 {
+		measure("-", os.Stdin)
+		return
+	}
+
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+
+		measure(name, f)
+		_ = f.Close()
+	}
+
+	if flag.NArg() > 1 {
+		report("total", total)
+	}
+}
+
+func report(name string, stats chunker.PaddingStats) {
+	fmt.Printf("%s: %d chunks, %d bytes, %d bytes padded, overhead %.3f%%\n",
+		name, stats.Chunks, stats.Bytes, stats.PaddedBytes, 100*stats.Overhead())
+}
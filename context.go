@@ -0,0 +1,98 @@
+package chunker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// readDeadliner is implemented by readers which support read deadlines, such
+// as net.Conn and os.File.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// NextContext works like Next, but returns ctx.Err() when ctx is cancelled.
+// Cancellation is checked before each read and between the calls to
+// NextSplitPoint. A read which is blocked when ctx is cancelled is interrupted
+// if the reader implements SetReadDeadline (e.g. net.Conn), by setting the
+// deadline to a time in the past. Afterwards, the deadline set with
+// Chunker.SetReadDeadline is restored, a deadline set on the reader directly
+// cannot be queried and is cleared.
+//
+// Cancellation does not lose any data: the data of the current chunk read so
+// far is kept, and the next call to Next or NextContext continues with it.
+func (c *Chunker) NextContext(ctx context.Context, data []byte) (Chunk, error) {
+	return c.nextChunk(ctx, data)
+}
+
+// SetReadDeadline sets the read deadline of the reader, which must implement
+// SetReadDeadline, and records it so that NextContext can restore it after
+// interrupting a read. The deadline is forgotten when the reader is replaced.
+func (c *Chunker) SetReadDeadline(t time.Time) error {
+	d, ok := c.rd.(readDeadliner)
+	if !ok {
+		return errors.New("reader does not support read deadlines")
+	}
+
+	if err := d.SetReadDeadline(t); err != nil {
+		return err
+	}
+
+	c.readDeadline = t
+	return nil
+}
+
+// readContext fills the buffer like io.ReadFull, ctx is checked between
+// reads. If ctx is cancelled, the number of bytes read so far and ctx.Err()
+// is returned.
+func (c *Chunker) readContext(ctx context.Context) (int, error) {
+	if d, ok := c.rd.(readDeadliner); ok && ctx.Done() != nil {
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		interrupted := false
+		go func() {
+			defer close(done)
+			select {
+			case <-ctx.Done():
+				// unblock a pending read
+				_ = d.SetReadDeadline(time.Unix(1, 0))
+				interrupted = true
+			case <-stop:
+			}
+		}()
+
+		defer func() {
+			close(stop)
+			<-done
+			if interrupted {
+				_ = d.SetReadDeadline(c.readDeadline)
+			}
+		}()
+	}
+
+	n := 0
+	for n < len(c.buf) {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+
+		m, err := c.rd.Read(c.buf[n:])
+		n += m
+
+		if err != nil {
+			// the error was caused by the deadline set above
+			if ctx.Err() != nil {
+				return n, ctx.Err()
+			}
+
+			if err == io.EOF && n > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,275 @@
+package chunker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// cancelReader returns at most max bytes per read and calls cancel after
+// every n reads.
+type cancelReader struct {
+	rd     io.Reader
+	max    int
+	n      int
+	reads  int
+	cancel func()
+}
+
+func (r *cancelReader) Read(p []byte) (int, error) {
+	r.reads++
+	if r.reads%r.n == 0 {
+		r.cancel()
+	}
+
+	if len(p) > r.max {
+		p = p[:r.max]
+	}
+
+	return r.rd.Read(p)
+}
+
+func compareChunks(t *testing.T, chunks []Chunk, want []chunk) {
+	if len(chunks) != len(want) {
+		t.Fatalf("wrong number of chunks: want %d, got %d", len(want), len(chunks))
+	}
+
+	pos := uint(0)
+	for i, c := range chunks {
+		if c.Start != pos || c.Length != want[i].Length || c.Cut != want[i].CutFP {
+			t.Fatalf("chunk %d: wrong chunk %d/%d/%016x, want %d/%d/%016x",
+				i, c.Start, c.Length, c.Cut, pos, want[i].Length, want[i].CutFP)
+		}
+
+		if !bytes.Equal(hashData(c.Data), want[i].Digest) {
+			t.Fatalf("chunk %d: wrong digest", i)
+		}
+
+		pos += c.Length
+	}
+}
+
+func TestNextContextResume(t *testing.T) {
+	buf := getRandom(23, 32*1024*1024)
+	rd := &cancelReader{rd: bytes.NewReader(buf), max: 100 * 1024, n: 7}
+	ch := New(rd, testPol)
+
+	var chunks []Chunk
+	cancelled := 0
+	for {
+		ctx, cancel := context.WithCancel(context.Background())
+		rd.cancel = cancel
+
+		c, err := ch.NextContext(ctx, nil)
+		cancel()
+		if err == context.Canceled {
+			cancelled++
+			continue
+		}
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		chunks = append(chunks, c)
+	}
+
+	if cancelled == 0 {
+		t.Fatal("no call was cancelled")
+	}
+
+	compareChunks(t, chunks, chunks1)
+}
+
+func TestNextContextCancelled(t *testing.T) {
+	buf := getRandom(23, 32*1024*1024)
+	ch := New(bytes.NewReader(buf), testPol)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for i := 0; i < 3; i++ {
+		_, err := ch.NextContext(ctx, nil)
+		if err != context.Canceled {
+			t.Fatalf("wrong error returned: %v", err)
+		}
+	}
+
+	chunks := testWithData(t, ch, chunks1, true)
+	compareChunks(t, chunks, chunks1)
+}
+
+var errDeadline = errors.New("deadline exceeded")
+
+// blockingReader returns data and then blocks until it is unblocked, which
+// returns io.EOF, or a deadline in the past is set.
+type blockingReader struct {
+	data     []byte
+	unblock  chan struct{}
+	deadline chan struct{}
+
+	// last is the deadline set last
+	last time.Time
+}
+
+func newBlockingReader(data []byte) *blockingReader {
+	return &blockingReader{
+		data:     data,
+		unblock:  make(chan struct{}),
+		deadline: make(chan struct{}, 1),
+	}
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	if len(r.data) > 0 {
+		n := copy(p, r.data)
+		r.data = r.data[n:]
+		return n, nil
+	}
+
+	select {
+	case <-r.unblock:
+		return 0, io.EOF
+	case <-r.deadline:
+		return 0, errDeadline
+	}
+}
+
+func (r *blockingReader) SetReadDeadline(t time.Time) error {
+	r.last = t
+	if !t.IsZero() && t.Before(time.Now()) {
+		select {
+		case r.deadline <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+
+	// clear a deadline which has not been noticed by Read
+	select {
+	case <-r.deadline:
+	default:
+	}
+
+	return nil
+}
+
+func TestNextContextBlockingReader(t *testing.T) {
+	buf := getRandom(23, 3*1024*1024+17*1024)
+	rd := newBlockingReader(buf)
+	ch := New(rd, testPol, WithBoundaries(64*1024, 1024*1024), WithAverageBits(18))
+
+	type result struct {
+		chunks []Chunk
+		err    error
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	res := make(chan result)
+	go func() {
+		var r result
+		for {
+			c, err := ch.NextContext(ctx, nil)
+			if err != nil {
+				r.err = err
+				break
+			}
+			r.chunks = append(r.chunks, c)
+		}
+		res <- r
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	var r result
+	select {
+	case r = <-res:
+	case <-time.After(5 * time.Second):
+		t.Fatal("NextContext did not return after cancellation")
+	}
+
+	if r.err != context.Canceled {
+		t.Fatalf("wrong error returned: %v", r.err)
+	}
+
+	// finish chunking after the reader returns io.EOF
+	close(rd.unblock)
+	chunks := r.chunks
+	for {
+		c, err := ch.Next(nil)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		chunks = append(chunks, c)
+	}
+
+	// compare with an uninterrupted chunker
+	ref := New(bytes.NewReader(buf), testPol, WithBoundaries(64*1024, 1024*1024), WithAverageBits(18))
+	var want []chunk
+	for {
+		c, err := ref.Next(nil)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want = append(want, chunk{Length: c.Length, CutFP: c.Cut, Digest: hashData(c.Data)})
+	}
+
+	compareChunks(t, chunks, want)
+}
+
+func TestNextContextReadDeadline(t *testing.T) {
+	rd := newBlockingReader(getRandom(23, 100*1024))
+	ch := New(rd, testPol)
+
+	deadline := time.Now().Add(time.Hour)
+	if err := ch.SetReadDeadline(deadline); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	res := make(chan error)
+	go func() {
+		_, err := ch.NextContext(ctx, nil)
+		res <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-res:
+		if err != context.Canceled {
+			t.Fatalf("wrong error returned: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("NextContext did not return after cancellation")
+	}
+
+	// the deadline is restored after the read has been interrupted
+	if !rd.last.Equal(deadline) {
+		t.Fatalf("wrong deadline after cancellation: want %v, got %v", deadline, rd.last)
+	}
+
+	ch.SetReader(bytes.NewReader(nil))
+	if err := ch.SetReadDeadline(deadline); err == nil {
+		t.Fatal("no error for reader without deadlines")
+	}
+}
@@ -0,0 +1,169 @@
+package chunker
+
+import (
+	"errors"
+	"hash"
+	"math/bits"
+)
+
+// CRCParams describes a CRC in the parameter model by Ross N. Williams, c.f.
+// "A Painless Guide to CRC Error Detection Algorithms".
+type CRCParams struct {
+	// Width is the width of the CRC in bits, between 1 and 64.
+	Width int
+
+	// Pol is the generator polynomial. The x^Width term is implicit and may
+	// be omitted, as is common in CRC catalogs.
+	Pol Pol
+
+	// Init is the initial value of the register.
+	Init uint64
+
+	// RefIn specifies that the bits of each input byte are processed least
+	// significant bit first.
+	RefIn bool
+
+	// RefOut specifies that the register is reflected before XorOut is
+	// applied.
+	RefOut bool
+
+	// XorOut is combined with the register by exclusive or to form the result.
+	XorOut uint64
+}
+
+// Parameters of some common CRCs.
+var (
+	// CRC32 is the CRC-32 used by Ethernet, zlib and PNG.
+	CRC32 = CRCParams{Width: 32, Pol: 0x04c11db7, Init: 0xffffffff, RefIn: true, RefOut: true, XorOut: 0xffffffff}
+	// CRC32C is the CRC-32 with the Castagnoli polynomial used by iSCSI.
+	CRC32C = CRCParams{Width: 32, Pol: 0x1edc6f41, Init: 0xffffffff, RefIn: true, RefOut: true, XorOut: 0xffffffff}
+	// CRC64XZ is the CRC-64 with the ECMA-182 polynomial used by xz.
+	CRC64XZ = CRCParams{Width: 64, Pol: 0x42f0e1eba9ea3693, Init: 1<<64 - 1, RefIn: true, RefOut: true, XorOut: 1<<64 - 1}
+)
+
+// CRC computes a table-driven CRC of all data written to it, it implements
+// hash.Hash64. The sum is the CRC as big-endian integer of Size bytes.
+type CRC struct {
+	params CRCParams
+	mask   uint64
+	table  [256]uint64
+	reg    uint64
+}
+
+var _ hash.Hash64 = &CRC{}
+
+// reflectBits returns the lowest width bits of x in reverse order.
+func reflectBits(x uint64, width int) uint64 {
+	return bits.Reverse64(x) >> uint(64-width)
+}
+
+// NewCRC returns a new CRC for the parameters p.
+func NewCRC(p CRCParams) (*CRC, error) {
+	if p.Width < 1 || p.Width > 64 {
+		return nil, errors.New("CRC width must be between 1 and 64")
+	}
+
+	if p.Width < 64 && p.Pol.Deg() > p.Width {
+		return nil, errors.New("degree of the CRC polynomial is larger than the width")
+	}
+
+	// for a width of 64 the shift results in zero and mask has all bits set
+	c := &CRC{params: p, mask: 1<<uint(p.Width) - 1}
+	c.params.Pol &= Pol(c.mask)
+
+	if p.RefIn {
+		// the register holds the reflected CRC in the lowest bits
+		pol := reflectBits(uint64(c.params.Pol), p.Width)
+		for i := range c.table {
+			r := uint64(i)
+			for j := 0; j < 8; j++ {
+				if r&1 == 1 {
+					r = r>>1 ^ pol
+				} else {
+					r >>= 1
+				}
+			}
+			c.table[i] = r
+		}
+	} else {
+		// the register holds the CRC in the highest bits
+		pol := uint64(c.params.Pol) << uint(64-p.Width)
+		for i := range c.table {
+			r := uint64(i) << 56
+			for j := 0; j < 8; j++ {
+				if r&(1<<63) != 0 {
+					r = r<<1 ^ pol
+				} else {
+					r <<= 1
+				}
+			}
+			c.table[i] = r
+		}
+	}
+
+	c.Reset()
+	return c, nil
+}
+
+// Reset resets the CRC to its initial state.
+func (c *CRC) Reset() {
+	init := c.params.Init & c.mask
+	if c.params.RefIn {
+		c.reg = reflectBits(init, c.params.Width)
+	} else {
+		c.reg = init << uint(64-c.params.Width)
+	}
+}
+
+// Write adds p to the CRC, it never returns an error.
+func (c *CRC) Write(p []byte) (int, error) {
+	reg := c.reg
+	if c.params.RefIn {
+		for _, b := range p {
+			reg = c.table[byte(reg)^b] ^ reg>>8
+		}
+	} else {
+		for _, b := range p {
+			reg = c.table[byte(reg>>56)^b] ^ reg<<8
+		}
+	}
+	c.reg = reg
+
+	return len(p), nil
+}
+
+// Sum64 returns the current CRC.
+func (c *CRC) Sum64() uint64 {
+	var crc uint64
+	if c.params.RefIn {
+		crc = c.reg
+	} else {
+		crc = c.reg >> uint(64-c.params.Width)
+	}
+
+	if c.params.RefIn != c.params.RefOut {
+		crc = reflectBits(crc, c.params.Width)
+	}
+
+	return (crc ^ c.params.XorOut) & c.mask
+}
+
+// Sum appends the current CRC to b and returns the resulting slice.
+func (c *CRC) Sum(b []byte) []byte {
+	crc := c.Sum64()
+	for i := c.Size() - 1; i >= 0; i-- {
+		b = append(b, byte(crc>>uint(8*i)))
+	}
+
+	return b
+}
+
+// Size returns the number of bytes Sum will return.
+func (c *CRC) Size() int {
+	return (c.params.Width + 7) / 8
+}
+
+// BlockSize returns the hash's underlying block size.
+func (c *CRC) BlockSize() int {
+	return 1
+}
@@ -0,0 +1,152 @@
+package chunker
+
+import (
+	"bytes"
+	"hash/crc32"
+	"hash/crc64"
+	"math/rand"
+	"testing"
+)
+
+// test vectors from the CRC catalogue by Greg Cook, the check value is the
+// CRC of the ASCII string "123456789"
+var crcTests = []struct {
+	name   string
+	params CRCParams
+	check  uint64
+}{
+	{"CRC-3/ROHC", CRCParams{3, 0x3, 0x7, true, true, 0x0}, 0x6},
+	{"CRC-4/G-704", CRCParams{4, 0x3, 0x0, true, true, 0x0}, 0x7},
+	{"CRC-5/USB", CRCParams{5, 0x05, 0x1f, true, true, 0x1f}, 0x19},
+	{"CRC-8/SMBUS", CRCParams{8, 0x07, 0x00, false, false, 0x00}, 0xf4},
+	{"CRC-8/MAXIM-DOW", CRCParams{8, 0x31, 0x00, true, true, 0x00}, 0xa1},
+	{"CRC-12/UMTS", CRCParams{12, 0x80f, 0x000, false, true, 0x000}, 0xdaf},
+	{"CRC-16/ARC", CRCParams{16, 0x8005, 0x0000, true, true, 0x0000}, 0xbb3d},
+	{"CRC-16/IBM-3740", CRCParams{16, 0x1021, 0xffff, false, false, 0x0000}, 0x29b1},
+	{"CRC-16/KERMIT", CRCParams{16, 0x1021, 0x0000, true, true, 0x0000}, 0x2189},
+	{"CRC-24/OPENPGP", CRCParams{24, 0x864cfb, 0xb704ce, false, false, 0x000000}, 0x21cf02},
+	{"CRC-32/ISO-HDLC", CRC32, 0xcbf43926},
+	{"CRC-32/ISCSI", CRC32C, 0xe3069283},
+	{"CRC-32/BZIP2", CRCParams{32, 0x04c11db7, 0xffffffff, false, false, 0xffffffff}, 0xfc891918},
+	{"CRC-32/MPEG-2", CRCParams{32, 0x04c11db7, 0xffffffff, false, false, 0x00000000}, 0x0376e6e7},
+	{"CRC-32/ISO-HDLC (x^32 included)", CRCParams{32, 0x104c11db7, 0xffffffff, true, true, 0xffffffff}, 0xcbf43926},
+	{"CRC-40/GSM", CRCParams{40, 0x0004820009, 0x0, false, false, 0xffffffffff}, 0xd4164fc646},
+	{"CRC-64/ECMA-182", CRCParams{64, 0x42f0e1eba9ea3693, 0x0, false, false, 0x0}, 0x6c40df5f0b497347},
+	{"CRC-64/GO-ISO", CRCParams{64, 0x1b, 1<<64 - 1, true, true, 1<<64 - 1}, 0xb90956c775a41001},
+	{"CRC-64/XZ", CRC64XZ, 0x995dc9bbdf1939fa},
+}
+
+func TestCRC(t *testing.T) {
+	for _, test := range crcTests {
+		c, err := NewCRC(test.params)
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+
+		_, _ = c.Write([]byte("1234"))
+		_, _ = c.Write([]byte("56789"))
+		if c.Sum64() != test.check {
+			t.Errorf("%v: wrong CRC: want %#x, got %#x", test.name, test.check, c.Sum64())
+		}
+
+		sum := c.Sum(nil)
+		if len(sum) != (test.params.Width+7)/8 {
+			t.Errorf("%v: wrong sum length %d", test.name, len(sum))
+		}
+
+		var crc uint64
+		for _, b := range sum {
+			crc = crc<<8 | uint64(b)
+		}
+
+		if crc != test.check {
+			t.Errorf("%v: wrong sum returned: %02x", test.name, sum)
+		}
+
+		c.Reset()
+		_, _ = c.Write([]byte("123456789"))
+		if c.Sum64() != test.check {
+			t.Errorf("%v: wrong CRC after Reset: %#x", test.name, c.Sum64())
+		}
+	}
+}
+
+func TestCRCStdlib(t *testing.T) {
+	c32, err := NewCRC(CRC32C)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c64, err := NewCRC(CRC64XZ)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	castagnoli := crc32.MakeTable(crc32.Castagnoli)
+	ecma := crc64.MakeTable(crc64.ECMA)
+
+	rnd := rand.New(rand.NewSource(23))
+	for i := 0; i < 100; i++ {
+		data := make([]byte, rnd.Intn(10000))
+		rnd.Read(data)
+
+		c32.Reset()
+		_, _ = c32.Write(data)
+		if want := uint64(crc32.Checksum(data, castagnoli)); c32.Sum64() != want {
+			t.Fatalf("wrong CRC-32C: want %#x, got %#x", want, c32.Sum64())
+		}
+
+		c64.Reset()
+		_, _ = c64.Write(data)
+		if want := crc64.Checksum(data, ecma); c64.Sum64() != want {
+			t.Fatalf("wrong CRC-64: want %#x, got %#x", want, c64.Sum64())
+		}
+	}
+}
+
+func TestCRCFingerprint(t *testing.T) {
+	// without init, reflection and xorout the CRC is the remainder of the
+	// message multiplied by x^Width
+	pol := Pol(0x104c11db7)
+	c, err := NewCRC(CRCParams{Width: 32, Pol: pol})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := getRandom(23, 4096)
+	_, _ = c.Write(data)
+
+	fp := Fingerprint(pol, append(data, bytes.Repeat([]byte{0}, 4)...))
+	if Pol(c.Sum64()) != fp {
+		t.Fatalf("CRC %#x is not the fingerprint %v", c.Sum64(), fp)
+	}
+}
+
+func TestCRCInvalid(t *testing.T) {
+	for _, p := range []CRCParams{
+		{Width: 0, Pol: 0x3},
+		{Width: 65, Pol: 0x3},
+		{Width: 8, Pol: 0x307},
+	} {
+		if _, err := NewCRC(p); err == nil {
+			t.Errorf("expected error for parameters %+v", p)
+		}
+	}
+}
+
+func BenchmarkCRC(b *testing.B) {
+	c, err := NewCRC(CRC64XZ)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	data := getRandom(23, 1024*1024)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		c.Reset()
+		_, _ = c.Write(data)
+	}
+}
@@ -0,0 +1,63 @@
+package chunker
+
+import "sort"
+
+// CutAt forces cuts at the given offsets, in addition to the content-defined
+// cuts. The offsets are counted from the start of the data, a forced cut ends
+// the current chunk before the byte at the offset and resets the rolling state
+// exactly as a natural cut does, so the data after it is chunked as if it
+// were a standalone stream. Offsets which have already been processed are
+// ignored. A Chunker reports forced cuts with the flag ChunkForced, see
+// LastCutForced for a BaseChunker.
+func (c *BaseChunker) CutAt(offsets ...uint) {
+	c.cuts = append(c.cuts, offsets...)
+	sort.Slice(c.cuts, func(i, j int) bool { return c.cuts[i] < c.cuts[j] })
+
+	// remove duplicates
+	cuts := c.cuts[:0]
+	for i, off := range c.cuts {
+		if i > 0 && off == c.cuts[i-1] {
+			continue
+		}
+		cuts = append(cuts, off)
+	}
+	c.cuts = cuts
+}
+
+// CutHere forces a cut after the data passed to NextSplitPoint so far: the
+// next call to NextSplitPoint returns zero if the current chunk is not empty.
+func (c *BaseChunker) CutHere() {
+	c.CutAt(c.offset)
+}
+
+// LastCutForced returns true if the last split point returned by
+// NextSplitPoint is a forced cut, see CutAt.
+func (c *BaseChunker) LastCutForced() bool {
+	return c.forced
+}
+
+// cutPending returns true if a forced cut is pending at the current offset
+// and the current chunk is not empty.
+func (c *BaseChunker) cutPending() bool {
+	return len(c.cuts) > 0 && c.cuts[0] == c.offset && c.count > 0
+}
+
+// nextForcedCut returns the index of the next forced cut in buf, or -1.
+// Forced cuts at the start of a chunk are ignored.
+func (c *BaseChunker) nextForcedCut(buf []byte) int {
+	for len(c.cuts) > 0 && (c.cuts[0] < c.offset || (c.cuts[0] == c.offset && c.count == 0)) {
+		c.cuts = c.cuts[1:]
+	}
+
+	if len(c.cuts) == 0 || c.cuts[0]-c.offset > uint(len(buf)) {
+		return -1
+	}
+
+	return int(c.cuts[0] - c.offset)
+}
+
+// CutHere forces a cut after the data read from the reader so far, e.g. in
+// follow mode after Next returned ErrNoProgress, see WithFollow.
+func (c *Chunker) CutHere() {
+	c.CutAt(c.offset + c.bmax - c.bpos)
+}
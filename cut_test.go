@@ -0,0 +1,206 @@
+package chunker
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// standaloneChunks returns the chunks of data for a new chunker.
+func standaloneChunks(t *testing.T, data []byte, opts ...option) []Chunk {
+	return standaloneChunksFrom(t, New(bytes.NewReader(data), testPol, opts...))
+}
+
+// standaloneChunksFrom returns all chunks returned by ch.
+func standaloneChunksFrom(t *testing.T, ch *Chunker) []Chunk {
+	var chunks []Chunk
+	for {
+		c, err := ch.Next(nil)
+		if err == io.EOF {
+			return chunks
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		chunks = append(chunks, c)
+	}
+}
+
+// checkFiles checks that the chunks of the concatenation of files are the
+// same as for each file chunked separately.
+func checkFiles(t *testing.T, chunks []Chunk, files [][]byte, opts ...option) {
+	offset := uint(0)
+	for i, file := range files {
+		for j, want := range standaloneChunks(t, file, opts...) {
+			if len(chunks) == 0 {
+				t.Fatalf("file %d: chunk %d is missing", i, j)
+			}
+			c := chunks[0]
+			chunks = chunks[1:]
+
+			if c.Start != offset+want.Start || c.Length != want.Length || !bytes.Equal(c.Data, want.Data) {
+				t.Fatalf("file %d, chunk %d: wrong chunk %d/%d, want %d/%d",
+					i, j, c.Start, c.Length, offset+want.Start, want.Length)
+			}
+
+			last := want.Start+want.Length == uint(len(file))
+			if c.Flags&ChunkForced != 0 && !last {
+				t.Fatalf("file %d, chunk %d: forced cut within a file", i, j)
+			}
+
+			// content-defined cuts have the same fingerprint
+			if !last && c.Cut != want.Cut {
+				t.Fatalf("file %d, chunk %d: wrong cut %016x, want %016x", i, j, c.Cut, want.Cut)
+			}
+		}
+
+		offset += uint(len(file))
+	}
+
+	if len(chunks) > 0 {
+		t.Fatalf("%d chunks too many", len(chunks))
+	}
+}
+
+func randomFiles(n int) [][]byte {
+	rnd := rand.New(rand.NewSource(5))
+	data := getRandom(23, 32*1024*1024)
+
+	var files [][]byte
+	for i := 0; i < n; i++ {
+		size := rnd.Intn(2 * 1024 * 1024)
+		if i%5 == 0 {
+			size = rnd.Intn(1000)
+		}
+
+		files = append(files, data[:size])
+		data = data[size:]
+	}
+
+	return files
+}
+
+func TestChunkerCutAt(t *testing.T) {
+	files := randomFiles(20)
+	opts := []option{WithBoundaries(64*1024, 1024*1024), WithAverageBits(17)}
+
+	var offsets []uint
+	var buf []byte
+	for _, file := range files {
+		offsets = append(offsets, uint(len(buf)))
+		buf = append(buf, file...)
+	}
+
+	ch := New(bytes.NewReader(buf), testPol, opts...)
+	ch.CutAt(offsets...)
+
+	var chunks []Chunk
+	forced := 0
+	for {
+		c, err := ch.Next(nil)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if c.Flags&ChunkForced != 0 {
+			forced++
+		}
+		chunks = append(chunks, c)
+	}
+
+	if forced == 0 {
+		t.Fatal("no forced cuts reported")
+	}
+
+	checkFiles(t, chunks, files, opts...)
+}
+
+func TestChunkerCutHere(t *testing.T) {
+	files := randomFiles(10)
+
+	rd := &growingReader{}
+	ch := New(rd, testPol, WithFollow())
+
+	var chunks []Chunk
+	for _, file := range files {
+		rd.data = append(rd.data, file...)
+		for {
+			c, err := ch.Next(nil)
+			if err == ErrNoProgress {
+				break
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			chunks = append(chunks, c)
+		}
+
+		ch.CutHere()
+	}
+
+	// the data of the last file is returned after Finish
+	ch.Finish()
+	for {
+		c, err := ch.Next(nil)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, c)
+	}
+
+	checkFiles(t, chunks, files)
+}
+
+func TestBaseChunkerCutHere(t *testing.T) {
+	files := randomFiles(10)
+	bc := NewBase(testPol)
+
+	var chunks []Chunk
+	var data []byte
+	pos := uint(0)
+	for _, file := range files {
+		for len(file) > 0 {
+			split, cut := bc.NextSplitPoint(file)
+			if split == -1 {
+				data = append(data, file...)
+				pos += uint(len(file))
+				break
+			}
+
+			data = append(data, file[:split]...)
+			file = file[split:]
+			pos += uint(split)
+			chunks = append(chunks, Chunk{Start: pos - uint(len(data)), Length: uint(len(data)), Cut: cut, Data: data})
+			data = nil
+		}
+
+		bc.CutHere()
+		split, cut := bc.NextSplitPoint(nil)
+		if len(data) == 0 {
+			if split != -1 {
+				t.Fatalf("forced cut for empty chunk returned")
+			}
+			continue
+		}
+
+		if split != 0 || !bc.LastCutForced() {
+			t.Fatalf("forced cut not returned, got %d", split)
+		}
+		chunks = append(chunks, Chunk{Start: pos - uint(len(data)), Length: uint(len(data)), Cut: cut, Data: data, Flags: ChunkForced})
+		data = nil
+	}
+
+	checkFiles(t, chunks, files)
+}
@@ -0,0 +1,83 @@
+package chunker
+
+// delimiterFailure returns the failure function of the Knuth-Morris-Pratt
+// algorithm for delim: the length of the longest proper prefix of
+// delim[:i+1] which is also a suffix of it.
+func delimiterFailure(delim []byte) []int {
+	fail := make([]int, len(delim))
+	k := 0
+	for i := 1; i < len(delim); i++ {
+		for k > 0 && delim[k] != delim[i] {
+			k = fail[k-1]
+		}
+
+		if delim[k] == delim[i] {
+			k++
+		}
+		fail[i] = k
+	}
+
+	return fail
+}
+
+// seekCut searches buf for the position of the cut after a hash match: the
+// end of the next delimiter within the remaining lookahead and MaxSize, or the
+// next aligned position if alignment is enabled. It returns the index before
+// which the buf should be split, or -1 if buf has been consumed.
+func (c *BaseChunker) seekCut(buf []byte) int {
+	limit := c.seekLeft
+	if max := c.MaxSize - c.count; max < limit {
+		limit = max
+	}
+
+	// alignment takes precedence over delimiters
+	if c.delim == nil || c.align > 1 {
+		if uint(len(buf)) >= limit {
+			return int(limit)
+		}
+
+		c.seekLeft -= uint(len(buf))
+		c.count += uint(len(buf))
+		return -1
+	}
+
+	delim, fail := c.delim, c.dfail
+	m := c.dmatch
+	for i, b := range buf {
+		if uint(i) >= limit {
+			return i
+		}
+
+		for m > 0 && delim[m] != b {
+			m = fail[m-1]
+		}
+
+		if delim[m] == b {
+			m++
+		}
+
+		if m == len(delim) {
+			return i + 1
+		}
+	}
+
+	if uint(len(buf)) >= limit {
+		return len(buf)
+	}
+
+	c.dmatch = m
+	c.seekLeft -= uint(len(buf))
+	c.count += uint(len(buf))
+	return -1
+}
+
+func (c *BaseChunker) setDelimiter(delim []byte, lookahead uint) {
+	if len(delim) == 0 {
+		c.delim = nil
+		return
+	}
+
+	c.delim = append([]byte(nil), delim...)
+	c.dfail = delimiterFailure(c.delim)
+	c.lookahead = lookahead
+}
@@ -0,0 +1,181 @@
+package chunker
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// randomLines returns lines of random printable text.
+func randomLines(seed int64, size int, delim []byte) []byte {
+	rnd := rand.New(rand.NewSource(seed))
+	buf := make([]byte, 0, size+300)
+	for len(buf) < size {
+		n := 20 + rnd.Intn(200)
+		for i := 0; i < n; i++ {
+			buf = append(buf, byte(' '+rnd.Intn(95)))
+		}
+		buf = append(buf, delim...)
+	}
+
+	return buf
+}
+
+func chunkWithDelimiter(t *testing.T, data []byte, opts ...option) []Chunk {
+	opts = append([]option{WithBoundaries(16*1024, 1024*1024), WithAverageBits(15)}, opts...)
+	return standaloneChunks(t, data, opts...)
+}
+
+func TestChunkerDelimiter(t *testing.T) {
+	for _, delim := range [][]byte{[]byte("\n"), []byte("\r\n"), []byte("--\n")} {
+		data := randomLines(23, 8*1024*1024, delim)
+		chunks := chunkWithDelimiter(t, data, WithDelimiter(delim, 4096))
+
+		if len(chunks) < 100 {
+			t.Fatalf("too few chunks: %d", len(chunks))
+		}
+
+		for i, c := range chunks {
+			if !bytes.HasSuffix(c.Data, delim) {
+				t.Fatalf("delimiter %q: chunk %d at %d does not end with the delimiter", delim, i, c.Start)
+			}
+		}
+
+		// the cuts are the same for a small buffer
+		small := chunkWithDelimiter(t, data, WithDelimiter(delim, 4096), WithBuffer(make([]byte, 1000)))
+		if len(small) != len(chunks) {
+			t.Fatalf("wrong number of chunks for small buffer: want %d, got %d", len(chunks), len(small))
+		}
+
+		for i := range chunks {
+			if small[i].Start != chunks[i].Start || small[i].Length != chunks[i].Length || small[i].Cut != chunks[i].Cut {
+				t.Fatalf("chunk %d differs for small buffer", i)
+			}
+		}
+	}
+}
+
+func TestChunkerDelimiterContentDefined(t *testing.T) {
+	data := randomLines(23, 4*1024*1024, []byte("\n"))
+	chunks := chunkWithDelimiter(t, data, WithDelimiter([]byte("\n"), 4096))
+
+	// insert a line at the start, all but the first chunks are the same
+	modified := append([]byte("a new line\n"), data...)
+	shifted := chunkWithDelimiter(t, modified, WithDelimiter([]byte("\n"), 4096))
+
+	ends := make(map[uint]bool)
+	for _, c := range chunks {
+		ends[c.Start+c.Length] = true
+	}
+
+	same := 0
+	for _, c := range shifted {
+		if ends[c.Start+c.Length-11] {
+			same++
+		}
+	}
+
+	if same < len(chunks)-2 {
+		t.Fatalf("only %d of %d cuts are the same after inserting a line", same, len(chunks))
+	}
+}
+
+func TestChunkerDelimiterLimits(t *testing.T) {
+	// without delimiters, the cut is made after the lookahead
+	data := getRandom(23, 4*1024*1024)
+	plain := chunkWithDelimiter(t, data)
+	chunks := chunkWithDelimiter(t, data, WithDelimiter([]byte("no such delimiter"), 100))
+
+	// the first cut is moved by exactly the lookahead
+	if len(plain) < 2 || chunks[0].Length != plain[0].Length+100 {
+		t.Fatalf("first cut at %d, want %d", chunks[0].Length, plain[0].Length+100)
+	}
+
+	// the lookahead is limited by MaxSize
+	chunks = standaloneChunks(t, data, WithBoundaries(16*1024, 20*1024), WithAverageBits(15),
+		WithDelimiter([]byte("no such delimiter"), 1024*1024))
+	for i, c := range chunks {
+		if c.Length > 20*1024 {
+			t.Fatalf("chunk %d is larger than MaxSize: %d", i, c.Length)
+		}
+	}
+}
+
+func TestDelimiterFailure(t *testing.T) {
+	for _, test := range []struct {
+		delim string
+		fail  []int
+	}{
+		{"\n", []int{0}},
+		{"aab", []int{0, 1, 0}},
+		{"abab", []int{0, 0, 1, 2}},
+		{"aaaa", []int{0, 1, 2, 3}},
+	} {
+		fail := delimiterFailure([]byte(test.delim))
+		for i := range fail {
+			if fail[i] != test.fail[i] {
+				t.Errorf("%q: wrong failure function %v, want %v", test.delim, fail, test.fail)
+				break
+			}
+		}
+	}
+}
+
+func TestSeekDelimiter(t *testing.T) {
+	rnd := rand.New(rand.NewSource(23))
+	for i := 0; i < 1000; i++ {
+		// a small alphabet produces many partial matches
+		data := make([]byte, 200)
+		for j := range data {
+			data[j] = 'a' + byte(rnd.Intn(2))
+		}
+		delim := data[rnd.Intn(150):][:1+rnd.Intn(5)]
+		delim = append([]byte(nil), delim...)
+
+		c := NewBase(testPol, WithBaseDelimiter(delim, 1000))
+		c.seeking = true
+		c.seekLeft = c.lookahead
+
+		// feed the data in pieces
+		pos, n := 0, -1
+		for pos < len(data) && n == -1 {
+			end := pos + 1 + rnd.Intn(10)
+			if end > len(data) {
+				end = len(data)
+			}
+
+			n = c.seekCut(data[pos:end])
+			if n == -1 {
+				pos = end
+			} else {
+				n += pos
+			}
+		}
+
+		want := bytes.Index(data, delim) + len(delim)
+		if n != want {
+			t.Fatalf("delimiter %q in %q: found end at %d, want %d", delim, data, n, want)
+		}
+	}
+}
+
+func BenchmarkChunkerDelimiter(b *testing.B) {
+	data := randomLines(23, 32*1024*1024, []byte("\n"))
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ch := New(bytes.NewReader(data), testPol, WithDelimiter([]byte("\n"), 4096))
+		for {
+			_, err := ch.Next(nil)
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package chunker
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+)
+
+// BlockSum is the signature of one block of a basis file: the Rabin
+// fingerprint of the block and its SHA-256 hash.
+type BlockSum struct {
+	Weak   uint64
+	Strong [sha256.Size]byte
+}
+
+// FileSignature describes a basis file block by block, so that a Delta
+// against it can be computed without access to the file itself.
+type FileSignature struct {
+	Pol       Pol
+	BlockSize int
+	Length    int64
+
+	// Blocks contains the signatures of all blocks in order, the last block
+	// is shorter than BlockSize if Length is not a multiple of BlockSize.
+	Blocks []BlockSum
+}
+
+// Signature reads basis until io.EOF and returns the signatures of all
+// blocks of blockSize bytes, using the polynomial pol for the fingerprints.
+func Signature(basis io.Reader, pol Pol, blockSize int) (*FileSignature, error) {
+	if err := checkDegree(pol.Deg()); err != nil {
+		return nil, err
+	}
+
+	if blockSize < 1 {
+		return nil, errors.New("block size must be positive")
+	}
+
+	sig := &FileSignature{Pol: pol, BlockSize: blockSize}
+	h := NewHash(pol)
+	buf := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(basis, buf)
+		if err == io.EOF {
+			return sig, nil
+		}
+
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+
+		h.Reset()
+		_, _ = h.Write(buf[:n])
+		sig.Blocks = append(sig.Blocks, BlockSum{
+			Weak:   h.Sum64(),
+			Strong: sha256.Sum256(buf[:n]),
+		})
+		sig.Length += int64(n)
+
+		if n < blockSize {
+			return sig, nil
+		}
+	}
+}
+
+// check returns an error if the polynomial, the block size or the number of
+// blocks of the signature is invalid.
+func (sig *FileSignature) check() error {
+	if err := checkDegree(sig.Pol.Deg()); err != nil {
+		return err
+	}
+
+	if sig.BlockSize < 1 {
+		return errors.New("block size must be positive")
+	}
+
+	n := sig.Length / int64(sig.BlockSize)
+	if sig.Length%int64(sig.BlockSize) != 0 {
+		n++
+	}
+
+	if sig.Length < 0 || n != int64(len(sig.Blocks)) {
+		return errors.New("length does not match the number of blocks")
+	}
+
+	return nil
+}
+
+// OpKind is the type of a DeltaOp.
+type OpKind uint8
+
+const (
+	// OpCopy copies Length bytes at Offset from the basis file.
+	OpCopy OpKind = iota
+	// OpLiteral inserts Data.
+	OpLiteral
+)
+
+// DeltaOp is an instruction to reconstruct new data from a basis file.
+type DeltaOp struct {
+	Kind   OpKind
+	Offset int64
+	Length int64
+	Data   []byte
+}
+
+// Delta reads newData until io.EOF and returns the operations to
+// reconstruct it from the basis file described by sig. The rolling
+// fingerprint of a window of sig.BlockSize bytes is slid over newData byte by
+// byte, so blocks of the basis are found at any offset. Candidate blocks with
+// a matching fingerprint are verified with SHA-256. Adjacent copies are
+// merged into a single operation. All literal data is held in memory until the
+// operations are returned. An error is returned if sig is invalid.
+func Delta(sig *FileSignature, newData io.Reader) ([]DeltaOp, error) {
+	if err := sig.check(); err != nil {
+		return nil, err
+	}
+	bs := sig.BlockSize
+
+	// index all full blocks, the short tail block can only match at the end
+	index := make(map[uint64][]int)
+	tail := -1
+	for i, b := range sig.Blocks {
+		if int64(i+1)*int64(bs) > sig.Length {
+			tail = i
+			break
+		}
+		index[b.Weak] = append(index[b.Weak], i)
+	}
+
+	d := &delta{sig: sig}
+	rh := NewRollingHash(sig.Pol, bs)
+	rd := bufio.NewReader(newData)
+
+	// buf contains all data since the last match, the window is at the end
+	var buf []byte
+	for {
+		b, err := rd.ReadByte()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		buf = append(buf, b)
+		rh.Roll(b)
+
+		if len(buf) < bs {
+			continue
+		}
+
+		if blocks, ok := index[rh.Digest()]; ok {
+			window := buf[len(buf)-bs:]
+			if i := d.findBlock(blocks, window, rh.Digest()); i >= 0 {
+				d.literal(buf[:len(buf)-bs])
+				d.copy(int64(i)*int64(bs), int64(bs))
+				buf = buf[:0]
+				rh.Reset()
+				continue
+			}
+		}
+	}
+
+	if tail >= 0 {
+		n := int(sig.Length - int64(tail)*int64(bs))
+		if len(buf) >= n {
+			end := buf[len(buf)-n:]
+			if d.findBlock([]int{tail}, end, uint64(Fingerprint(sig.Pol, end))) >= 0 {
+				d.literal(buf[:len(buf)-n])
+				d.copy(int64(tail)*int64(bs), int64(n))
+				buf = buf[:0]
+			}
+		}
+	}
+	d.literal(buf)
+
+	return d.ops, nil
+}
+
+// delta collects the operations for Delta.
+type delta struct {
+	sig *FileSignature
+	ops []DeltaOp
+}
+
+// findBlock returns the first block in blocks with the same content as
+// data, whose fingerprint is fp, or -1. The block following the last copied
+// block is checked first, so that copies can be merged.
+func (d *delta) findBlock(blocks []int, data []byte, fp uint64) int {
+	var strong [sha256.Size]byte
+	hashed := false
+
+	match := func(i int) bool {
+		b := d.sig.Blocks[i]
+		if b.Weak != fp {
+			return false
+		}
+
+		if !hashed {
+			strong = sha256.Sum256(data)
+			hashed = true
+		}
+
+		return bytes.Equal(b.Strong[:], strong[:])
+	}
+
+	if n := len(d.ops); n > 0 && d.ops[n-1].Kind == OpCopy {
+		last := d.ops[n-1]
+		next := int((last.Offset + last.Length) / int64(d.sig.BlockSize))
+		for _, i := range blocks {
+			if i == next && match(i) {
+				return i
+			}
+		}
+	}
+
+	for _, i := range blocks {
+		if match(i) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (d *delta) copy(offset, length int64) {
+	if n := len(d.ops); n > 0 {
+		last := &d.ops[n-1]
+		if last.Kind == OpCopy && last.Offset+last.Length == offset {
+			last.Length += length
+			return
+		}
+	}
+
+	d.ops = append(d.ops, DeltaOp{Kind: OpCopy, Offset: offset, Length: length})
+}
+
+func (d *delta) literal(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	if n := len(d.ops); n > 0 {
+		last := &d.ops[n-1]
+		if last.Kind == OpLiteral {
+			last.Data = append(last.Data, data...)
+			last.Length = int64(len(last.Data))
+			return
+		}
+	}
+
+	d.ops = append(d.ops, DeltaOp{
+		Kind:   OpLiteral,
+		Length: int64(len(data)),
+		Data:   append([]byte(nil), data...),
+	})
+}
+
+// Patch reconstructs the new data from basis and the operations returned by
+// Delta and writes it to w.
+func Patch(basis io.ReaderAt, delta []DeltaOp, w io.Writer) error {
+	for _, op := range delta {
+		switch op.Kind {
+		case OpCopy:
+			n, err := io.Copy(w, io.NewSectionReader(basis, op.Offset, op.Length))
+			if err != nil {
+				return err
+			}
+
+			if n != op.Length {
+				return io.ErrUnexpectedEOF
+			}
+		case OpLiteral:
+			_, err := w.Write(op.Data)
+			if err != nil {
+				return err
+			}
+		default:
+			return errors.New("invalid delta operation")
+		}
+	}
+
+	return nil
+}
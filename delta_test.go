@@ -0,0 +1,185 @@
+package chunker
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// edit applies random insertions, deletions and modifications to data.
+func edit(rnd *rand.Rand, data []byte, n int) []byte {
+	res := append([]byte(nil), data...)
+	for i := 0; i < n; i++ {
+		pos := rnd.Intn(len(res) + 1)
+		switch rnd.Intn(3) {
+		case 0:
+			ins := make([]byte, 1+rnd.Intn(100))
+			rnd.Read(ins)
+			res = append(res[:pos], append(ins, res[pos:]...)...)
+		case 1:
+			end := pos + rnd.Intn(100)
+			if end > len(res) {
+				end = len(res)
+			}
+			res = append(res[:pos], res[end:]...)
+		case 2:
+			if pos < len(res) {
+				res[pos] ^= 0xff
+			}
+		}
+	}
+
+	return res
+}
+
+func testDelta(t *testing.T, basis, data []byte, blockSize int) []DeltaOp {
+	sig, err := Signature(bytes.NewReader(basis), testPol, blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sig.Length != int64(len(basis)) {
+		t.Fatalf("wrong length in signature: want %d, got %d", len(basis), sig.Length)
+	}
+
+	ops, err := Delta(sig, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = Patch(bytes.NewReader(basis), ops, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("patched data is different (len %d, want %d)", buf.Len(), len(data))
+	}
+
+	return ops
+}
+
+func literalBytes(ops []DeltaOp) (n int) {
+	for _, op := range ops {
+		if op.Kind == OpLiteral {
+			n += len(op.Data)
+		}
+	}
+
+	return n
+}
+
+func TestDelta(t *testing.T) {
+	basis := getRandom(23, 1024*1024+124)[:1024*1024+123]
+	rnd := rand.New(rand.NewSource(5))
+
+	for _, blockSize := range []int{64, 700, 4096} {
+		for _, edits := range []int{0, 1, 10, 50} {
+			data := edit(rnd, basis, edits)
+			ops := testDelta(t, basis, data, blockSize)
+
+			// every edit invalidates at most two blocks
+			if limit := edits * (2*blockSize + 100); literalBytes(ops) > limit {
+				t.Errorf("block size %d, %d edits: too many literal bytes: %d > %d",
+					blockSize, edits, literalBytes(ops), limit)
+			}
+		}
+	}
+}
+
+func TestDeltaIdentical(t *testing.T) {
+	basis := getRandom(23, 100*1000+20)[:100*1000+17]
+	ops := testDelta(t, basis, basis, 1000)
+
+	if len(ops) != 1 || ops[0].Kind != OpCopy || ops[0].Offset != 0 || ops[0].Length != int64(len(basis)) {
+		t.Fatalf("identical data must be a single copy, got %d ops", len(ops))
+	}
+}
+
+func TestDeltaMoved(t *testing.T) {
+	basis := getRandom(23, 64*1024)
+
+	// swap both halves, prepend some bytes
+	data := append([]byte("foobar"), basis[32*1024:]...)
+	data = append(data, basis[:32*1024]...)
+	ops := testDelta(t, basis, data, 512)
+
+	if literalBytes(ops) != 6 {
+		t.Fatalf("wrong number of literal bytes: %d", literalBytes(ops))
+	}
+}
+
+func TestDeltaEmpty(t *testing.T) {
+	data := getRandom(23, 5000)
+
+	ops := testDelta(t, nil, data, 100)
+	if len(ops) != 1 || ops[0].Kind != OpLiteral {
+		t.Fatalf("expected a single literal for empty basis, got %d ops", len(ops))
+	}
+
+	ops = testDelta(t, data, nil, 100)
+	if len(ops) != 0 {
+		t.Fatalf("expected no ops for empty data, got %d", len(ops))
+	}
+
+	testDelta(t, data[:50], data[:50], 100)
+	testDelta(t, data[:50], data[:49], 100)
+}
+
+func TestDeltaInvalid(t *testing.T) {
+	_, err := Signature(bytes.NewReader(nil), testPol, 0)
+	if err == nil {
+		t.Fatal("expected error for block size 0")
+	}
+
+	_, err = Signature(bytes.NewReader(nil), 0, 100)
+	if err == nil {
+		t.Fatal("expected error for unsupported polynomial")
+	}
+
+	sig, err := Signature(bytes.NewReader(getRandom(23, 1000)), testPol, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, modify := range []func(s *FileSignature){
+		func(s *FileSignature) { s.Pol = 0 },
+		func(s *FileSignature) { s.Pol = 0x11 },
+		func(s *FileSignature) { s.BlockSize = 0 },
+		func(s *FileSignature) { s.Length++ },
+		func(s *FileSignature) { s.Length = -1 },
+		func(s *FileSignature) { s.Blocks = s.Blocks[:5] },
+	} {
+		invalid := *sig
+		modify(&invalid)
+		if _, err := Delta(&invalid, bytes.NewReader(nil)); err == nil {
+			t.Fatalf("expected error for invalid signature %d", i)
+		}
+	}
+
+	err = Patch(bytes.NewReader([]byte("foo")), []DeltaOp{{Kind: OpCopy, Offset: 1, Length: 5}}, &bytes.Buffer{})
+	if err == nil {
+		t.Fatal("expected error for copy beyond the end of the basis")
+	}
+}
+
+func BenchmarkDelta(b *testing.B) {
+	basis := getRandom(23, 8*1024*1024)
+	data := edit(rand.New(rand.NewSource(5)), basis, 100)
+
+	sig, err := Signature(bytes.NewReader(basis), testPol, 4096)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := Delta(sig, bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -16,14 +16,31 @@ optimising calculations in the chunker.
 A random polynomial is chosen selecting 64 random bits, masking away bits
 64..54 and setting bit 53 to one (otherwise the polynomial is not of the
 desired degree) and bit 0 to one (otherwise the polynomial is trivially
-reducible), so that 51 bits are chosen at random.
+reducible), so that 52 bits are chosen at random.
 
 This process is repeated until Irreducible() returns true, then this
 polynomials is returned. If this doesn't happen after 1 million tries, the
 function returns an error. The probability for selecting an irreducible
-polynomial at random is about 7.5% ( (2^53-2)/53 / 2^51), so the probability
-that no irreducible polynomial has been found after 100 tries is lower than
-0.04%.
+polynomial at random is about 3.8% ( (2^53-2)/53 / 2^52), so the probability
+that no irreducible polynomial has been found after 100 tries is about 2%.
+
+Polynomials of Other Degrees
+
+The chunker also works with irreducible polynomials of any degree between 8
+and 53, for example for shorter digests or for compatibility with other
+tools using 48 bit fingerprints. RandomPolynomialDegree() and
+DerivePolynomialDegree() return such polynomials. The digest has as many bits
+as the degree of the polynomial, so the number of average bits should be
+well below the degree. New() and NewBase() panic if it is not smaller than
+the degree.
+
+Deriving a Polynomial from a Key
+
+PolynomialFromKey() derives the polynomial deterministically from a secret
+key, e.g. a repository master key, so that it does not need to be stored
+separately. The derivation is versioned and uses HKDF-Expand with SHA-256, the
+details are described in the function documentation and test vectors are
+contained in the tests, so that other implementations can reproduce it.
 
 Verifying Irreducible Polynomials
 
@@ -59,6 +76,18 @@ the following script can be used:
 
 All irreducible polynomials from the list are written to the output.
 
+The package can also inspect polynomials itself: Factor() returns the
+factorization into irreducible polynomials, Order() and IsPrimitive() return
+the order of a polynomial and whether it is primitive, and Irreducibles()
+enumerates all irreducible polynomials of a given degree.
+
+CRCs
+
+The same polynomial arithmetic is the basis of CRCs. NewCRC returns a
+table-driven CRC implementing hash.Hash64 for arbitrary parameters in the
+model by Williams (width, polynomial, init, reflection of input and output and
+final xor), the parameters for CRC-32, CRC-32C and CRC-64/XZ are predefined.
+
 Background Literature
 
 An introduction to Rabin Fingerprints/Checksums can be found in the following articles:
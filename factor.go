@@ -0,0 +1,409 @@
+package chunker
+
+import (
+	"errors"
+	"math/bits"
+	"sort"
+)
+
+// Factor is an irreducible factor of a polynomial together with its
+// multiplicity.
+type Factor struct {
+	Pol          Pol
+	Multiplicity int
+}
+
+// Factor returns the factorization of x into irreducible polynomials over
+// F_2, sorted by the factors. For the constant polynomials 0 and 1, nil is
+// returned.
+//
+// The factorization consists of three steps: square-free factorization,
+// distinct-degree factorization and equal-degree factorization with the
+// algorithm by Cantor and Zassenhaus.
+func (x Pol) Factor() []Factor {
+	if x.Deg() < 1 {
+		return nil
+	}
+
+	var res []Factor
+	for _, sf := range squareFree(x) {
+		for _, dd := range distinctDegree(sf.Pol) {
+			for _, f := range equalDegree(dd.pol, dd.deg) {
+				res = append(res, Factor{Pol: f, Multiplicity: sf.Multiplicity})
+			}
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Pol < res[j].Pol })
+	return res
+}
+
+// derivative returns the formal derivative of x. Over F_2, only the terms
+// with an odd exponent remain.
+func (x Pol) derivative() Pol {
+	return (x >> 1) & 0x5555555555555555
+}
+
+// sqrt returns the square root of x, which must only have terms with even
+// exponents.
+func (x Pol) sqrt() Pol {
+	var res Pol
+	for i := uint(0); i < 32; i++ {
+		res |= ((x >> (2 * i)) & 1) << i
+	}
+
+	return res
+}
+
+// squareFree returns the square-free factorization of x: a list of pairwise
+// coprime square-free polynomials and their multiplicities.
+func squareFree(x Pol) []Factor {
+	var res []Factor
+
+	c := x.GCD(x.derivative())
+	w := x.Div(c)
+	for i := 1; w != 1; i++ {
+		y := w.GCD(c)
+		if f := w.Div(y); f != 1 {
+			res = append(res, Factor{Pol: f, Multiplicity: i})
+		}
+		w = y
+		c = c.Div(y)
+	}
+
+	// the remaining factors have multiplicities divisible by two
+	if c != 1 {
+		for _, f := range squareFree(c.sqrt()) {
+			res = append(res, Factor{Pol: f.Pol, Multiplicity: 2 * f.Multiplicity})
+		}
+	}
+
+	return res
+}
+
+// ddFactor is the product of all irreducible factors of degree deg of a
+// polynomial.
+type ddFactor struct {
+	pol Pol
+	deg int
+}
+
+// distinctDegree splits the square-free polynomial x into products of all
+// irreducible factors of the same degree.
+func distinctDegree(x Pol) []ddFactor {
+	var res []ddFactor
+
+	b := newBarrett(x)
+	h := Pol(2).Mod(x)
+	for i := 1; x.Deg() >= 2*i; i++ {
+		// x^(2^i) - x is the product of all irreducible polynomials with a
+		// degree dividing i
+		h = b.mulMod(h, h)
+		if g := x.GCD(h.Add(2)); g != 1 {
+			res = append(res, ddFactor{pol: g, deg: i})
+			x = x.Div(g)
+			b = newBarrett(x)
+			h = h.Mod(x)
+		}
+	}
+
+	if x != 1 {
+		res = append(res, ddFactor{pol: x, deg: x.Deg()})
+	}
+
+	return res
+}
+
+// equalDegree splits x, a product of distinct irreducible polynomials of
+// degree d, into its factors.
+func equalDegree(x Pol, d int) []Pol {
+	if x.Deg() <= d {
+		return []Pol{x}
+	}
+
+	b := newBarrett(x)
+	mask := Pol(1)<<uint(x.Deg()) - 1
+	state := uint64(0x9e3779b97f4a7c15)
+	for {
+		// choose a (deterministic) pseudo-random polynomial a of degree below
+		// deg(x) with xorshift
+		state ^= state << 13
+		state ^= state >> 7
+		state ^= state << 17
+		a := Pol(state) & mask
+
+		// the trace a + a^2 + ... + a^(2^(d-1)) is either zero or one modulo
+		// each factor, each with probability 1/2
+		t, s := a, a
+		for i := 1; i < d; i++ {
+			s = b.mulMod(s, s)
+			t ^= s
+		}
+
+		g := x.GCD(t)
+		if g != 1 && g != x {
+			return append(equalDegree(g, d), equalDegree(x.Div(g), d)...)
+		}
+	}
+}
+
+// InverseMod returns the polynomial y with x*y = 1 mod m. If x and m are not
+// coprime, no such polynomial exists and an error is returned.
+func (x Pol) InverseMod(m Pol) (Pol, error) {
+	// extended Euclidean algorithm, keeping s_i*x = r_i mod m
+	r0, r1 := m, x.Mod(m)
+	s0, s1 := Pol(0), Pol(1)
+	for r1 != 0 {
+		q, r := r0.DivMod(r1)
+		qs, _ := q.MulOverflow(s1)
+		r0, r1 = r1, r
+		s0, s1 = s1, s0.Add(qs)
+	}
+
+	if r0 != 1 {
+		return 0, errors.New("polynomial is not invertible")
+	}
+
+	return s0.Mod(m), nil
+}
+
+// Order returns the order of x, which is the smallest e > 0 so that x
+// divides X^e - 1. If no such e exists, because x is constant or divisible
+// by X, zero is returned.
+func (x Pol) Order() uint64 {
+	if x.Deg() < 1 || x&1 == 0 {
+		return 0
+	}
+
+	// the order of p^k for an irreducible p is the order of p multiplied by
+	// the smallest power of two not below k, the order of x is the least
+	// common multiple of the orders of its factors
+	res := uint64(1)
+	for _, f := range x.Factor() {
+		o := orderIrreducible(f.Pol)
+		for t := 1; t < f.Multiplicity; t *= 2 {
+			o *= 2
+		}
+		res = res / gcd(res, o) * o
+	}
+
+	return res
+}
+
+// orderIrreducible returns the order of the irreducible polynomial x, which
+// must not be X. It is a divisor of 2^deg(x)-1.
+func orderIrreducible(x Pol) uint64 {
+	b := newBarrett(x)
+	n := uint64(1)<<uint(x.Deg()) - 1
+
+	o := n
+	for _, p := range primeFactors(n) {
+		for o%p == 0 && b.expMod(Pol(2).Mod(x), o/p) == 1 {
+			o /= p
+		}
+	}
+
+	return o
+}
+
+// IsPrimitive returns true iff x is a primitive polynomial, i.e. it is
+// irreducible and X generates the multiplicative group of F_2[X]/x, so that
+// the order of x is 2^deg(x)-1.
+func (x Pol) IsPrimitive() bool {
+	if x.Deg() < 1 || x&1 == 0 || !x.Irreducible() {
+		return false
+	}
+
+	return orderIrreducible(x) == uint64(1)<<uint(x.Deg())-1
+}
+
+// IrreducibleIterator enumerates all irreducible polynomials of a given
+// degree in increasing order.
+type IrreducibleIterator struct {
+	deg  int
+	next Pol
+	step Pol
+	cur  Pol
+	done bool
+}
+
+// Irreducibles returns an iterator over all irreducible polynomials of
+// degree deg, which must be between 1 and 63.
+func Irreducibles(deg int) *IrreducibleIterator {
+	if deg < 1 || deg > 63 {
+		panic("degree must be between 1 and 63")
+	}
+
+	it := &IrreducibleIterator{deg: deg, next: 1 << uint(deg), step: 1}
+	if deg > 1 {
+		// polynomials without the constant term are divisible by X
+		it.next |= 1
+		it.step = 2
+	}
+
+	return it
+}
+
+// Next advances the iterator to the next irreducible polynomial, which is
+// then available through Pol. It returns false when there are no more
+// polynomials.
+func (it *IrreducibleIterator) Next() bool {
+	for !it.done {
+		f := it.next
+		it.next += it.step
+		if it.next.Deg() != it.deg {
+			it.done = true
+		}
+
+		if f.Irreducible() {
+			it.cur = f
+			return true
+		}
+	}
+
+	return false
+}
+
+// Pol returns the current polynomial.
+func (it *IrreducibleIterator) Pol() Pol {
+	return it.cur
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return a
+}
+
+// mulMod64 returns a*b mod n.
+func mulMod64(a, b, n uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	return bits.Rem64(hi, lo, n)
+}
+
+// expMod64 returns a^e mod n.
+func expMod64(a, e, n uint64) uint64 {
+	res := uint64(1)
+	a %= n
+	for e > 0 {
+		if e&1 == 1 {
+			res = mulMod64(res, a, n)
+		}
+		a = mulMod64(a, a, n)
+		e >>= 1
+	}
+
+	return res
+}
+
+var smallPrimes = []uint64{2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37}
+
+// isPrime returns true iff n is prime, using the Miller-Rabin test with a
+// set of bases which is deterministic for all 64 bit integers.
+func isPrime(n uint64) bool {
+	if n < 2 {
+		return false
+	}
+
+	for _, p := range smallPrimes {
+		if n%p == 0 {
+			return n == p
+		}
+	}
+
+	d := n - 1
+	s := 0
+	for d%2 == 0 {
+		d /= 2
+		s++
+	}
+
+outer:
+	for _, a := range smallPrimes {
+		x := expMod64(a, d, n)
+		if x == 1 || x == n-1 {
+			continue
+		}
+
+		for i := 1; i < s; i++ {
+			x = mulMod64(x, x, n)
+			if x == n-1 {
+				continue outer
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// pollardRho returns a non-trivial divisor of the odd composite n.
+func pollardRho(n uint64) uint64 {
+	for c := uint64(1); ; c++ {
+		f := func(x uint64) uint64 {
+			x = mulMod64(x, x, n)
+			y := x + c
+			if y < x || y >= n {
+				y -= n
+			}
+			return y
+		}
+
+		x, y, d := uint64(2), uint64(2), uint64(1)
+		for d == 1 {
+			x = f(x)
+			y = f(f(y))
+			if x > y {
+				d = gcd(x-y, n)
+			} else {
+				d = gcd(y-x, n)
+			}
+		}
+
+		if d != n {
+			return d
+		}
+	}
+}
+
+// primeFactors returns the distinct prime factors of n in increasing order.
+func primeFactors(n uint64) []uint64 {
+	var res []uint64
+	for _, p := range smallPrimes {
+		if n%p == 0 {
+			res = append(res, p)
+			for n%p == 0 {
+				n /= p
+			}
+		}
+	}
+
+	var split func(n uint64)
+	split = func(n uint64) {
+		switch {
+		case n == 1:
+		case isPrime(n):
+			res = append(res, n)
+		default:
+			d := pollardRho(n)
+			split(d)
+			split(n / d)
+		}
+	}
+	split(n)
+
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+
+	// remove duplicates
+	var out []uint64
+	for _, p := range res {
+		if len(out) == 0 || out[len(out)-1] != p {
+			out = append(out, p)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,214 @@
+package chunker
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+var polFactorTests = []struct {
+	x       Pol
+	factors []Factor
+}{
+	{0, nil},
+	{1, nil},
+	{2, []Factor{{2, 1}}},
+	{parseBin("100"), []Factor{{2, 2}}},
+	{parseBin("101"), []Factor{{3, 2}}},
+	{parseBin("111"), []Factor{{7, 1}}},
+	{parseBin("1100"), []Factor{{2, 2}, {3, 1}}},
+	{parseBin("10001"), []Factor{{3, 4}}},
+	{parseBin("11111"), []Factor{{parseBin("11111"), 1}}},
+	{parseBin("1100001111"), []Factor{{parseBin("11"), 1}, {parseBin("10011"), 2}}},
+	{0x3DA3358B4DC173, []Factor{{0x3DA3358B4DC173, 1}}},
+	{0x230d2259defd, []Factor{{0x7, 1}, {0x13, 1}, {0xf1, 1}, {0x15b550e55, 1}}},
+}
+
+func TestPolFactor(t *testing.T) {
+	for i, test := range polFactorTests {
+		factors := test.x.Factor()
+		if !reflect.DeepEqual(factors, test.factors) {
+			t.Errorf("test %d: wrong factors for %v: want %v, got %v", i, test.x, test.factors, factors)
+		}
+	}
+}
+
+func TestPolFactorRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(23))
+	for i := 0; i < 2000; i++ {
+		x := Pol(rnd.Uint64() >> uint(rnd.Intn(63)))
+		if x.Deg() < 1 {
+			continue
+		}
+
+		// build the product of all factors
+		prod := Pol(1)
+		for _, f := range x.Factor() {
+			if !f.Pol.Irreducible() {
+				t.Fatalf("factor %v of %v is not irreducible", f.Pol, x)
+			}
+
+			for j := 0; j < f.Multiplicity; j++ {
+				prod = prod.Mul(f.Pol)
+			}
+		}
+
+		if prod != x {
+			t.Fatalf("product of factors of %v is %v", x, prod)
+		}
+	}
+}
+
+func TestPolFactorIrreducible(t *testing.T) {
+	for _, test := range polIrredTests {
+		factors := test.f.Factor()
+		irred := len(factors) == 1 && factors[0].Multiplicity == 1
+		if irred != test.irred {
+			t.Errorf("factorization of %v disagrees with irreducibility test: %v", test.f, factors)
+		}
+	}
+}
+
+func TestPolInverseMod(t *testing.T) {
+	rnd := rand.New(rand.NewSource(23))
+	for i := 0; i < 1000; i++ {
+		x := Pol(rnd.Uint64())
+		m := Pol(rnd.Uint64() >> uint(rnd.Intn(62)))
+		if m.Deg() < 1 {
+			continue
+		}
+
+		inv, err := x.InverseMod(m)
+		if x.GCD(m) != 1 {
+			if err == nil {
+				t.Fatalf("inverse of %v mod %v returned, but gcd is %v", x, m, x.GCD(m))
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if inv.Deg() >= m.Deg() || x.MulMod(inv, m) != 1 {
+			t.Fatalf("wrong inverse for %v mod %v: %v", x, m, inv)
+		}
+	}
+}
+
+var polOrderTests = []struct {
+	x     Pol
+	order uint64
+}{
+	{0, 0},
+	{1, 0},
+	{2, 0},
+	{parseBin("11"), 1},
+	{parseBin("101"), 2},
+	{parseBin("111"), 3},
+	{parseBin("10011"), 15},
+	{parseBin("11111"), 5},
+	{parseBin("10001"), 4},
+	{parseBin("1111"), 4},
+	{parseBin("10111"), 7},
+	{parseBin("110101"), 15},
+}
+
+func TestPolOrder(t *testing.T) {
+	for i, test := range polOrderTests {
+		o := test.x.Order()
+		if o != test.order {
+			t.Errorf("test %d: wrong order for %v: want %d, got %d", i, test.x, test.order, o)
+		}
+	}
+
+	for _, test := range polIrredTests {
+		if !test.irred {
+			continue
+		}
+
+		o := test.f.Order()
+		if (1<<53-1)%o != 0 || Pol(2).ExpMod(o, test.f) != 1 {
+			t.Errorf("wrong order for %v: %d", test.f, o)
+		}
+	}
+}
+
+func TestIrreduciblesAndPrimitives(t *testing.T) {
+	// number of irreducible and primitive polynomials by degree
+	irreducibles := []int{0, 2, 1, 2, 3, 6, 9, 18, 30, 56, 99, 186, 335}
+	primitives := []int{0, 1, 1, 2, 2, 6, 6, 18, 16, 48, 60, 176, 144}
+
+	for deg := 1; deg < len(irreducibles); deg++ {
+		var n, prim int
+		last := Pol(0)
+		for it := Irreducibles(deg); it.Next(); {
+			f := it.Pol()
+			if f <= last || f.Deg() != deg {
+				t.Fatalf("iterator returned %v after %v for degree %d", f, last, deg)
+			}
+			last = f
+
+			n++
+			if f.IsPrimitive() {
+				prim++
+				if f.Order() != 1<<uint(deg)-1 {
+					t.Errorf("primitive polynomial %v has order %d", f, f.Order())
+				}
+			}
+		}
+
+		if n != irreducibles[deg] {
+			t.Errorf("wrong number of irreducible polynomials of degree %d: want %d, got %d",
+				deg, irreducibles[deg], n)
+		}
+
+		if prim != primitives[deg] {
+			t.Errorf("wrong number of primitive polynomials of degree %d: want %d, got %d",
+				deg, primitives[deg], prim)
+		}
+	}
+}
+
+func TestIrreduciblesDegree63(t *testing.T) {
+	it := Irreducibles(63)
+	if !it.Next() {
+		t.Fatal("no irreducible polynomial of degree 63 found")
+	}
+
+	// x^63 + x + 1 is the smallest irreducible polynomial of degree 63
+	if it.Pol() != 1<<63|3 {
+		t.Fatalf("wrong polynomial returned: %v", it.Pol())
+	}
+}
+
+func TestPrimeFactors(t *testing.T) {
+	for _, test := range []struct {
+		n       uint64
+		factors []uint64
+	}{
+		{1, nil},
+		{2, []uint64{2}},
+		{1<<53 - 1, []uint64{6361, 69431, 20394401}},
+		{1<<63 - 1, []uint64{7, 73, 127, 337, 92737, 649657}},
+		{1<<64 - 1, []uint64{3, 5, 17, 257, 641, 65537, 6700417}},
+		{18446744073709551557, []uint64{18446744073709551557}},
+	} {
+		factors := primeFactors(test.n)
+		if !reflect.DeepEqual(factors, test.factors) {
+			t.Errorf("wrong factors for %d: want %v, got %v", test.n, test.factors, factors)
+		}
+	}
+}
+
+func BenchmarkPolFactor(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Pol(0x230d2259defd).Factor()
+	}
+}
+
+func BenchmarkPolOrder(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		testPol.Order()
+	}
+}
@@ -0,0 +1,217 @@
+package chunker
+
+import (
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// ErrFileChanged is returned by FileChunker when the size of the file changed
+// while it was chunked.
+var ErrFileChanged = errors.New("file changed size while it was chunked")
+
+// FileChunker splits a local file into chunks, see ChunkFile.
+type FileChunker struct {
+	f    *os.File
+	size int64
+
+	// the file is mapped into memory, pos is the start of the next chunk
+	mapping []byte
+	pos     int
+	base    *BaseChunker
+
+	// the file is read if it cannot be mapped
+	ch *Chunker
+
+	closed bool
+}
+
+// ChunkFile opens the file at path for chunking with polynomial pol. On
+// Linux, the file is mapped into memory and split without copying it: the
+// Data of a Chunk returned by Next points into the mapping, it is valid until
+// Close is called and must not be modified. Accessing Data after Close crashes
+// the program, use NextCopy for chunks which are used afterwards. On other
+// systems, and for files which cannot be mapped, the file is read and each
+// chunk is returned in a newly allocated buffer.
+//
+// The file must not be modified while it is chunked. A change of the size of
+// the file is detected, Next returns ErrFileChanged in this case. The
+// content of chunks returned before may also have changed.
+func ChunkFile(path string, pol Pol, opts ...baseOption) (*FileChunker, error) {
+	return chunkFile(path, pol, true, opts...)
+}
+
+func chunkFile(path string, pol Pol, mapFile bool, opts ...baseOption) (*FileChunker, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	fc := &FileChunker{
+		f:    f,
+		size: fi.Size(),
+		base: NewBase(pol, opts...),
+	}
+
+	if mapFile && fi.Mode().IsRegular() && fi.Size() > 0 && int64(int(fi.Size())) == fi.Size() {
+		fc.mapping, err = mmapFile(f, int(fi.Size()))
+		if err != nil {
+			fc.mapping = nil
+		}
+	}
+
+	if fc.mapping == nil {
+		fc.ch = &Chunker{
+			BaseChunker: *fc.base,
+			chunkerBuffer: chunkerBuffer{
+				buf: make([]byte, chunkerBufSize),
+				rd:  f,
+			},
+		}
+	}
+
+	return fc, nil
+}
+
+// Next returns the next chunk of the file. When the last chunk has been
+// returned, all subsequent calls yield an io.EOF error. Each call checks the
+// size of the file with Stat.
+//
+// If the file is mapped, the Data of the chunk points into the mapping and
+// must not be accessed after Close, see ChunkFile.
+func (fc *FileChunker) Next() (Chunk, error) {
+	return fc.next(nil, false)
+}
+
+// NextCopy works like Next, but the data of the chunk is stored in data if it
+// is large enough, otherwise in a newly allocated buffer. Unlike the data
+// returned by Next, it stays valid after Close.
+func (fc *FileChunker) NextCopy(data []byte) (Chunk, error) {
+	return fc.next(data, true)
+}
+
+// next implements Next and NextCopy, the data of a mapped file is copied into
+// data if copyData is set.
+func (fc *FileChunker) next(data []byte, copyData bool) (Chunk, error) {
+	if fc.closed {
+		return Chunk{}, os.ErrClosed
+	}
+
+	if err := fc.checkSize(); err != nil {
+		return Chunk{}, err
+	}
+
+	if fc.ch != nil {
+		return fc.ch.Next(data)
+	}
+
+	if fc.pos >= len(fc.mapping) {
+		return Chunk{}, io.EOF
+	}
+
+	buf := fc.mapping[fc.pos:]
+	var split int
+	var cut uint64
+	err := fc.access(func() {
+		split, cut = fc.base.NextSplitPoint(buf)
+	})
+	if err != nil {
+		return Chunk{}, err
+	}
+
+	// the rest of the file is the last chunk
+	flags := fc.base.lastFlags()
+	if split == -1 {
+		split = len(buf)
+		cut = fc.base.digest
+		flags = fc.base.pendingFlags()
+	}
+
+	chunk := Chunk{
+		Start:  uint(fc.pos),
+		Length: uint(split),
+		Cut:    cut,
+		Data:   buf[:split:split],
+		Flags:  flags,
+	}
+
+	if copyData {
+		err := fc.access(func() {
+			chunk.Data = append(data[:0], chunk.Data...)
+		})
+		if err != nil {
+			return Chunk{}, err
+		}
+	}
+	fc.pos += split
+
+	return chunk, nil
+}
+
+// access calls fn, which reads from the mapping. Accessing the mapping beyond
+// the end of a file which has been truncated raises a fault, which is turned
+// into ErrFileChanged.
+func (fc *FileChunker) access(fn func()) (err error) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+
+		if _, ok := r.(runtime.Error); ok && fc.checkSize() == ErrFileChanged {
+			err = ErrFileChanged
+			return
+		}
+
+		panic(r)
+	}()
+
+	fn()
+	return nil
+}
+
+// checkSize returns ErrFileChanged if the size of the file changed.
+func (fc *FileChunker) checkSize() error {
+	fi, err := fc.f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if fi.Size() != fc.size {
+		return ErrFileChanged
+	}
+
+	return nil
+}
+
+// Close unmaps and closes the file. The data of the chunks returned by Next
+// for a mapped file becomes invalid: accessing it afterwards crashes the
+// program with a fault which cannot be recovered. Chunks returned by NextCopy
+// are not affected.
+func (fc *FileChunker) Close() error {
+	if fc.closed {
+		return os.ErrClosed
+	}
+	fc.closed = true
+
+	var err error
+	if fc.mapping != nil {
+		err = munmapFile(fc.mapping)
+		fc.mapping = nil
+	}
+
+	if cerr := fc.f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
@@ -0,0 +1,45 @@
+package chunker
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestChunkFileTruncatedMapping(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chunker-file-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := tempFile(t, dir, getRandom(23, 8*1024*1024))
+	fc, err := ChunkFile(name, testPol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fc.Close()
+
+	if fc.mapping == nil {
+		t.Fatal("file was not mapped")
+	}
+
+	// accessing the pages beyond the end of the file raises a fault
+	if err := os.Truncate(name, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	err = fc.access(func() {
+		fc.base.NextSplitPoint(fc.mapping)
+	})
+	if err != ErrFileChanged {
+		t.Fatalf("wrong error for truncated file: %v", err)
+	}
+
+	err = fc.access(func() {
+		_ = append([]byte(nil), fc.mapping...)
+	})
+	if err != ErrFileChanged {
+		t.Fatalf("wrong error for copying from truncated file: %v", err)
+	}
+}
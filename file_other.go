@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package chunker
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile returns an error, files are only mapped on Linux.
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	return nil, errors.New("mapping files is not supported")
+}
+
+func munmapFile(data []byte) error {
+	return nil
+}
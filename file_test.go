@@ -0,0 +1,245 @@
+package chunker
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tempFile writes data to a new file in dir and returns its path.
+func tempFile(t testing.TB, dir string, data []byte) string {
+	name := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(name, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return name
+}
+
+func testChunkFile(t *testing.T, data []byte, mapFile bool) {
+	dir, err := ioutil.TempDir("", "chunker-file-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fc, err := chunkFile(tempFile(t, dir, data), testPol, mapFile, WithBaseRepeatRuns())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var chunks []Chunk
+	for {
+		c, err := fc.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		chunks = append(chunks, c)
+	}
+
+	want := standaloneChunks(t, data, WithRepeatRuns())
+	if len(chunks) != len(want) {
+		t.Fatalf("wrong number of chunks: want %d, got %d", len(want), len(chunks))
+	}
+
+	for i, c := range chunks {
+		w := want[i]
+		if c.Start != w.Start || c.Length != w.Length || c.Cut != w.Cut || c.Flags != w.Flags || !bytes.Equal(c.Data, w.Data) {
+			t.Fatalf("wrong chunk %d: want %d/%d/%016x, got %d/%d/%016x",
+				i, w.Start, w.Length, w.Cut, c.Start, c.Length, c.Cut)
+		}
+	}
+
+	if err := fc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fc.Next(); err != os.ErrClosed {
+		t.Fatalf("wrong error after Close: %v", err)
+	}
+}
+
+func TestChunkFile(t *testing.T) {
+	for _, data := range [][]byte{
+		getRandom(23, 32*1024*1024),
+		append(getRandom(23, 3*1024*1024), make([]byte, 10*1024*1024)...),
+		[]byte("foobar"),
+		nil,
+	} {
+		testChunkFile(t, data, true)
+		testChunkFile(t, data, false)
+	}
+}
+
+func TestChunkFileChanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chunker-file-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, mapFile := range []bool{true, false} {
+		name := tempFile(t, dir, getRandom(23, 8*1024*1024))
+		fc, err := chunkFile(name, testPol, mapFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := fc.Next(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Truncate(name, 4*1024*1024); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := fc.Next(); err != ErrFileChanged {
+			t.Fatalf("wrong error for truncated file: %v", err)
+		}
+
+		if err := fc.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestChunkFileCopy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chunker-file-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := getRandom(23, 8*1024*1024)
+	name := tempFile(t, dir, data)
+
+	for _, mapFile := range []bool{true, false} {
+		fc, err := chunkFile(name, testPol, mapFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var chunks []Chunk
+		for {
+			c, err := fc.NextCopy(nil)
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			chunks = append(chunks, c)
+		}
+
+		if err := fc.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// the data is still accessible after Close
+		want := standaloneChunks(t, data)
+		if len(chunks) != len(want) {
+			t.Fatalf("wrong number of chunks: want %d, got %d", len(want), len(chunks))
+		}
+
+		for i, c := range chunks {
+			if c.Start != want[i].Start || !bytes.Equal(c.Data, want[i].Data) {
+				t.Fatalf("wrong chunk %d: %d/%d", i, c.Start, c.Length)
+			}
+		}
+	}
+
+	// the buffer passed to NextCopy is used if it is large enough
+	fc, err := ChunkFile(name, testPol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fc.Close()
+
+	buf := make([]byte, 8*1024*1024)
+	c, err := fc.NextCopy(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if &c.Data[0] != &buf[0] || !bytes.Equal(c.Data, data[:c.Length]) {
+		t.Fatal("data was not stored in the buffer")
+	}
+}
+
+func TestChunkFileMissing(t *testing.T) {
+	_, err := ChunkFile(filepath.Join(os.TempDir(), "chunker-missing-file"), testPol)
+	if !os.IsNotExist(err) {
+		t.Fatalf("wrong error for missing file: %v", err)
+	}
+}
+
+func benchmarkFile(b *testing.B, chunk func(name string) error) {
+	dir, err := ioutil.TempDir("", "chunker-file-")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := tempFile(b, dir, getRandom(23, 128*1024*1024))
+
+	b.ResetTimer()
+	b.SetBytes(128 * 1024 * 1024)
+
+	for i := 0; i < b.N; i++ {
+		if err := chunk(name); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkChunkFile(b *testing.B) {
+	benchmarkFile(b, func(name string) error {
+		fc, err := ChunkFile(name, testPol)
+		if err != nil {
+			return err
+		}
+
+		for {
+			_, err := fc.Next()
+			if err == io.EOF {
+				return fc.Close()
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	})
+}
+
+func BenchmarkChunkFileReader(b *testing.B) {
+	buf := make([]byte, MaxSize)
+	benchmarkFile(b, func(name string) error {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+
+		ch := New(f, testPol)
+		for {
+			_, err := ch.Next(buf)
+			if err == io.EOF {
+				return f.Close()
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	})
+}
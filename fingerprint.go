@@ -0,0 +1,87 @@
+package chunker
+
+import "hash"
+
+// Fingerprint returns the Rabin fingerprint of data for the polynomial pol:
+// the bytes of data are interpreted as the coefficients of a polynomial
+// (most significant bit of the first byte first), the fingerprint is this
+// polynomial modulo pol. Leading zero bytes do not change the fingerprint.
+// The degree of pol must be between 8 and 53.
+func Fingerprint(pol Pol, data []byte) Pol {
+	h := NewHash(pol)
+	_, _ = h.Write(data)
+	return Pol(h.Sum64())
+}
+
+// Combine returns the fingerprint of the concatenation A||B for the
+// polynomial pol from the fingerprints fpA of A and fpB of B and the length
+// of B in bytes, without access to the data itself. This uses
+//
+//	f(A||B) = f(A) * x^(8*len(B)) + f(B) mod pol
+//
+// as described by Broder, c.f. "Some Applications of Rabin's Fingerprinting
+// Method".
+func Combine(pol Pol, fpA, fpB Pol, lenB uint64) Pol {
+	b := newBarrett(pol)
+	shift := b.expMod(Pol(1<<8).Mod(pol), lenB)
+	return b.mulMod(fpA.Mod(pol), shift).Add(fpB.Mod(pol))
+}
+
+// Hash computes the Rabin fingerprint of all data written to it, it
+// implements hash.Hash64. The sum is the fingerprint as big-endian uint64.
+type Hash struct {
+	pol    Pol
+	tab    *tables
+	shift  uint
+	digest uint64
+}
+
+var _ hash.Hash64 = &Hash{}
+
+// NewHash returns a new Hash for polynomial pol, the degree of pol must be
+// between 8 and 53.
+func NewHash(pol Pol) *Hash {
+	return &Hash{
+		pol:   pol,
+		tab:   polTables(pol),
+		shift: uint(pol.Deg() - 8),
+	}
+}
+
+// Write adds p to the fingerprint, it never returns an error.
+func (h *Hash) Write(p []byte) (int, error) {
+	digest := h.digest
+	for _, b := range p {
+		digest = updateDigest(digest, h.shift, h.tab, b)
+	}
+	h.digest = digest
+
+	return len(p), nil
+}
+
+// Sum appends the current fingerprint to b and returns the resulting slice.
+func (h *Hash) Sum(b []byte) []byte {
+	d := h.digest
+	return append(b, byte(d>>56), byte(d>>48), byte(d>>40), byte(d>>32),
+		byte(d>>24), byte(d>>16), byte(d>>8), byte(d))
+}
+
+// Sum64 returns the current fingerprint.
+func (h *Hash) Sum64() uint64 {
+	return h.digest
+}
+
+// Reset resets the Hash to its initial state.
+func (h *Hash) Reset() {
+	h.digest = 0
+}
+
+// Size returns the number of bytes Sum will return.
+func (h *Hash) Size() int {
+	return 8
+}
+
+// BlockSize returns the hash's underlying block size.
+func (h *Hash) BlockSize() int {
+	return 1
+}
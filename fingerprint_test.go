@@ -0,0 +1,131 @@
+package chunker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+)
+
+func appendByte(hash Pol, b byte, pol Pol) Pol {
+	hash <<= 8
+	hash |= Pol(b)
+
+	return hash.Mod(pol)
+}
+
+// naiveFingerprint computes the fingerprint of data byte by byte.
+func naiveFingerprint(pol Pol, data []byte) Pol {
+	var fp Pol
+	for _, b := range data {
+		fp = appendByte(fp, b, pol)
+	}
+
+	return fp
+}
+
+func TestFingerprint(t *testing.T) {
+	rnd := rand.New(rand.NewSource(23))
+	for _, pol := range []Pol{testPol, 0x2482734cacca49, 0x11b} {
+		for _, n := range []int{0, 1, 7, 8, 100, 4096} {
+			data := make([]byte, n)
+			rnd.Read(data)
+
+			fp := Fingerprint(pol, data)
+			want := naiveFingerprint(pol, data)
+			if fp != want {
+				t.Errorf("pol %v, length %d: wrong fingerprint: want %v, got %v", pol, n, want, fp)
+			}
+
+			if fp.Deg() >= pol.Deg() {
+				t.Errorf("fingerprint %v is not reduced modulo %v", fp, pol)
+			}
+
+			// leading zeros do not change the fingerprint
+			padded := append(make([]byte, 17), data...)
+			if Fingerprint(pol, padded) != fp {
+				t.Errorf("pol %v, length %d: leading zeros change the fingerprint", pol, n)
+			}
+		}
+	}
+
+	// a message shorter than the polynomial is its own fingerprint
+	if fp := Fingerprint(testPol, []byte{0x12, 0x34, 0x56}); fp != 0x123456 {
+		t.Errorf("wrong fingerprint %v", fp)
+	}
+}
+
+func TestHash(t *testing.T) {
+	data := getRandom(23, 1024*1024)
+	want := Fingerprint(testPol, data)
+
+	rnd := rand.New(rand.NewSource(5))
+	h := NewHash(testPol)
+	for buf := data; len(buf) > 0; {
+		n := rnd.Intn(10000)
+		if n > len(buf) {
+			n = len(buf)
+		}
+
+		_, err := h.Write(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf = buf[n:]
+	}
+
+	if Pol(h.Sum64()) != want {
+		t.Fatalf("wrong hash: want %v, got %v", want, Pol(h.Sum64()))
+	}
+
+	sum := h.Sum([]byte{0xff})
+	if len(sum) != 1+h.Size() || sum[0] != 0xff || binary.BigEndian.Uint64(sum[1:]) != uint64(want) {
+		t.Fatalf("wrong sum returned: %02x", sum)
+	}
+
+	h.Reset()
+	if h.Sum64() != 0 {
+		t.Fatalf("Reset() did not reset the hash")
+	}
+}
+
+func TestCombine(t *testing.T) {
+	data := getRandom(23, 64*1024)
+
+	rnd := rand.New(rand.NewSource(5))
+	for i := 0; i < 100; i++ {
+		split := rnd.Intn(len(data) + 1)
+		a, b := data[:split], data[split:]
+
+		fpA := Fingerprint(testPol, a)
+		fpB := Fingerprint(testPol, b)
+		res := Combine(testPol, fpA, fpB, uint64(len(b)))
+		want := Fingerprint(testPol, data)
+		if res != want {
+			t.Fatalf("split at %d: wrong fingerprint: want %v, got %v", split, want, res)
+		}
+	}
+
+	// a sequence of zero bytes shifts the fingerprint
+	fp := Fingerprint(testPol, data)
+	zeros := bytes.Repeat([]byte{0}, 1000)
+	if Combine(testPol, fp, 0, 1000) != Fingerprint(testPol, append(data, zeros...)) {
+		t.Fatalf("wrong fingerprint for appended zero bytes")
+	}
+}
+
+func BenchmarkFingerprint(b *testing.B) {
+	data := getRandom(23, 1024*1024)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		Fingerprint(testPol, data)
+	}
+}
+
+func BenchmarkCombine(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Combine(testPol, 0x123456789, 0x987654321, 8*1024*1024)
+	}
+}
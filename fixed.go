@@ -0,0 +1,98 @@
+package chunker
+
+import (
+	"context"
+	"io"
+)
+
+// FixedTail specifies how a fixed-size Chunker handles the last chunk if it
+// is shorter than the block size.
+type FixedTail uint8
+
+const (
+	// TailKeep returns the tail as a shorter last chunk.
+	TailKeep FixedTail = iota
+	// TailMerge appends the tail to the previous chunk, so the last chunk is
+	// between one and two blocks long.
+	TailMerge
+)
+
+// NewFixed returns a new Chunker that splits the data read from rd into
+// chunks of size bytes instead of content-defined chunks, see WithFixedSize.
+// NewFixed panics if size is zero.
+func NewFixed(rd io.Reader, size uint, opts ...option) *Chunker {
+	if size == 0 {
+		panic("size of fixed-size chunks must be positive")
+	}
+
+	return New(rd, 0, append([]option{WithFixedSize(size)}, opts...)...)
+}
+
+// nextFixedSplitPoint returns the index before which the buf should be split
+// into fixed-size chunks, or -1.
+func (c *BaseChunker) nextFixedSplitPoint(buf []byte) (int, uint64) {
+	n := c.fixedSize - c.count
+	if uint(len(buf)) < n {
+		c.count += uint(len(buf))
+		return -1, 0
+	}
+
+	c.reset()
+	return int(n), 0
+}
+
+// nextChunk returns the next chunk for Next and NextContext.
+func (c *Chunker) nextChunk(ctx context.Context, data []byte) (Chunk, error) {
+	if c.fixedSize == 0 || c.fixedTail != TailMerge {
+		return c.next(ctx, data)
+	}
+
+	// each chunk is held back until the next one is known, so that the tail
+	// can be appended to it
+	for {
+		chunk, err := c.next(ctx, c.scratch)
+		if err == io.EOF && c.hasHeld {
+			c.hasHeld = false
+			res := c.held
+			res.Data = append(data[:0], c.held.Data...)
+			return res, nil
+		}
+
+		if err != nil {
+			return Chunk{}, err
+		}
+
+		if !c.hasHeld {
+			c.hold(chunk)
+			continue
+		}
+
+		res := c.held
+		res.Data = append(data[:0], c.held.Data...)
+
+		// only the last chunk is shorter and not cut early
+		if chunk.Length < c.fixedSize && chunk.Flags&^ChunkRepeated == 0 {
+			if chunk.Flags == 0 || res.Data[0] != chunk.Data[0] {
+				res.Flags &^= ChunkRepeated
+			}
+
+			res.Data = append(res.Data, chunk.Data...)
+			res.Length += chunk.Length
+			res.Cut = chunk.Cut
+			c.scratch = chunk.Data[:0]
+			c.hasHeld = false
+			return res, nil
+		}
+
+		c.hold(chunk)
+		return res, nil
+	}
+}
+
+// hold stores chunk, its data buffer is swapped with the buffer for reading
+// the next chunk.
+func (c *Chunker) hold(chunk Chunk) {
+	c.scratch = c.held.Data[:0]
+	c.held = chunk
+	c.hasHeld = true
+}
@@ -1,11 +1,14 @@
 package chunker
 
+import "time"
+
 type option func(*Chunker)
 type baseOption func(*BaseChunker)
 
 // WithAverageBits allows to control the frequency of chunk discovery:
 // the lower averageBits, the higher amount of chunks will be identified.
 // The default value is 20 bits, so chunks will be of 1MiB size on average.
+// averageBits must be smaller than the degree of the polynomial.
 func WithBaseAverageBits(averageBits int) baseOption {
 	return func(c *BaseChunker) { c.splitmask = (1 << uint64(averageBits)) - 1 }
 }
@@ -18,9 +21,47 @@ func WithBaseBoundaries(min, max uint) baseOption {
 	}
 }
 
+// WithBaseDelimiter moves each content-defined cut behind the next occurrence
+// of delim (e.g. a newline) within lookahead bytes, so chunks end with
+// complete records. If no delimiter is found within lookahead bytes or before
+// the chunk reaches MaxSize, the cut is made there.
+func WithBaseDelimiter(delim []byte, lookahead uint) baseOption {
+	return func(c *BaseChunker) { c.setDelimiter(delim, lookahead) }
+}
+
+// WithBaseAlignment moves each content-defined cut forward to the next
+// multiple of n bytes, MinSize is rounded up and MaxSize is rounded down to a
+// multiple of n. NewBase panics if MaxSize is smaller than n. Delimiters are
+// ignored when an alignment is set.
+func WithBaseAlignment(n uint) baseOption {
+	return func(c *BaseChunker) {
+		c.align = n
+		c.alignHybrid = false
+	}
+}
+
+// WithBaseHybridAlignment works like WithBaseAlignment, but the digest is
+// only tested at multiples of n bytes, so all cuts are content-defined. Since
+// only one in n positions is tested, the average chunk size is multiplied by
+// n, the average bits should be reduced accordingly.
+func WithBaseHybridAlignment(n uint) baseOption {
+	return func(c *BaseChunker) {
+		c.align = n
+		c.alignHybrid = true
+	}
+}
+
+// WithBaseRepeatRuns skips the table work for runs of a single repeated byte,
+// e.g. zeros, without changing the split points. Whether a chunk consists of
+// a single repeated byte is reported by LastChunkRepeated.
+func WithBaseRepeatRuns() baseOption {
+	return func(c *BaseChunker) { c.runs = true }
+}
+
 // WithAverageBits allows to control the frequency of chunk discovery:
 // the lower averageBits, the higher amount of chunks will be identified.
 // The default value is 20 bits, so chunks will be of 1MiB size on average.
+// averageBits must be smaller than the degree of the polynomial.
 func WithAverageBits(averageBits int) option {
 	return func(c *Chunker) { c.splitmask = (1 << uint64(averageBits)) - 1 }
 }
@@ -33,7 +74,92 @@ func WithBoundaries(min, max uint) option {
 	}
 }
 
+// WithDelimiter moves each content-defined cut behind the next occurrence of
+// delim (e.g. a newline) within lookahead bytes, so chunks end with complete
+// records. If no delimiter is found within lookahead bytes or before the chunk
+// reaches MaxSize, the cut is made there.
+func WithDelimiter(delim []byte, lookahead uint) option {
+	return func(c *Chunker) { c.setDelimiter(delim, lookahead) }
+}
+
+// WithAlignment moves each content-defined cut forward to the next multiple
+// of n bytes, MinSize is rounded up and MaxSize is rounded down to a multiple
+// of n. New panics if MaxSize is smaller than n. Delimiters are ignored when
+// an alignment is set.
+func WithAlignment(n uint) option {
+	return func(c *Chunker) {
+		c.align = n
+		c.alignHybrid = false
+	}
+}
+
+// WithHybridAlignment works like WithAlignment, but the digest is only tested
+// at multiples of n bytes, so all cuts are content-defined. Since only one in
+// n positions is tested, the average chunk size is multiplied by n, the
+// average bits should be reduced accordingly.
+func WithHybridAlignment(n uint) option {
+	return func(c *Chunker) {
+		c.align = n
+		c.alignHybrid = true
+	}
+}
+
+// WithFixedSize makes the Chunker split the data into chunks of size bytes
+// instead of content-defined chunks, the last chunk is shorter unless
+// WithFixedTail is used. The polynomial is not used and Cut has no meaning.
+func WithFixedSize(size uint) option {
+	return func(c *Chunker) { c.fixedSize = size }
+}
+
+// WithFixedTail sets how the last chunk of a fixed-size Chunker is handled if
+// it is shorter than the block size, the default is TailKeep.
+func WithFixedTail(tail FixedTail) option {
+	return func(c *Chunker) { c.fixedTail = tail }
+}
+
+// WithRepeatRuns skips the table work for runs of a single repeated byte,
+// e.g. zeros, without changing the chunks. Chunks which consist of a single
+// repeated byte are returned with the flag ChunkRepeated.
+func WithRepeatRuns() option {
+	return func(c *Chunker) { c.runs = true }
+}
+
+// WithSparse enables WithRepeatRuns and, on Linux, skips the holes of sparse
+// files: if the reader is an *os.File, the holes found with SEEK_DATA and
+// SEEK_HOLE are returned as zeros without reading them from the file.
+func WithSparse() option {
+	return func(c *Chunker) { c.sparse = true }
+}
+
 // WithBuffer allows to set custom buffer for chunker.
 func WithBuffer(buf []byte) option {
 	return func(c *Chunker) { c.buf = buf }
 }
+
+// WithFollow enables follow mode for growing files and live streams: io.EOF
+// returned by the reader means that no data is available yet. Next keeps the
+// current chunk pending and returns ErrNoProgress, the next call continues
+// with the data appended in the meantime. Finish must be called when all data
+// has been written to flush the last chunk.
+func WithFollow() option {
+	return func(c *Chunker) { c.follow = true }
+}
+
+// WithStreaming enables streaming mode: instead of filling the whole buffer,
+// each read processes whatever data the reader returns, so chunks are
+// returned as soon as their data is available.
+func WithStreaming() option {
+	return func(c *Chunker) { c.streaming = true }
+}
+
+// WithMaxLatency enables streaming mode (see WithStreaming) and bounds the
+// time data is pending: when no cut was found within d after the first byte of
+// a chunk was read, the pending data is returned as a chunk with the flag
+// ChunkFlushed, and the next chunk starts with a fresh state. Reads are done
+// in a separate goroutine so that a blocking reader does not delay the chunk.
+func WithMaxLatency(d time.Duration) option {
+	return func(c *Chunker) {
+		c.streaming = true
+		c.maxLatency = d
+	}
+}
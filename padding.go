@@ -0,0 +1,175 @@
+package chunker
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// Padding computes the length a chunk is padded to before it is stored, so
+// that the stored size does not reveal the exact chunk length.
+type Padding interface {
+	// PaddedLength returns the padded length for chunk c. The result is at
+	// least c.Length+1, so that there is room for the padding marker written
+	// by Pad.
+	PaddedLength(c Chunk) uint
+}
+
+// ExponentialPadding pads chunks to exponentially growing buckets: the
+// padded length only has the Bits most significant bits set. With Bits = 1
+// lengths are padded to the next power of two, each additional bit halves
+// the maximal overhead (and doubles the number of buckets). A zero value is
+// treated as Bits = 1.
+type ExponentialPadding struct {
+	Bits uint
+}
+
+// PaddedLength returns the padded length for c.
+func (p ExponentialPadding) PaddedLength(c Chunk) uint {
+	keep := p.Bits
+	if keep == 0 {
+		keep = 1
+	}
+
+	n := c.Length + 1
+	l := uint(bits.Len(n))
+	if l <= keep {
+		return n
+	}
+
+	mask := uint(1)<<(l-keep) - 1
+	return (n + mask) &^ mask
+}
+
+// KeyedPadding pads each chunk by a pseudo-random amount of up to MaxPercent
+// percent of its length. The amount is derived from Key, the length and the
+// cut fingerprint of the chunk using HMAC-SHA256, so identical chunks are
+// always padded identically and deduplication is not affected.
+type KeyedPadding struct {
+	Key        []byte
+	MaxPercent uint
+}
+
+// PaddedLength returns the padded length for c.
+func (p KeyedPadding) PaddedLength(c Chunk) uint {
+	max := uint64(c.Length) * uint64(p.MaxPercent) / 100
+
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], uint64(c.Length))
+	binary.LittleEndian.PutUint64(buf[8:], c.Cut)
+
+	mac := hmac.New(sha256.New, p.Key)
+	_, _ = mac.Write(buf[:])
+	r := binary.LittleEndian.Uint64(mac.Sum(nil))
+
+	return c.Length + 1 + uint(r%(max+1))
+}
+
+// PaddedChunk is a chunk together with the length it is padded to.
+type PaddedChunk struct {
+	Chunk
+	PaddedLength uint
+}
+
+// PaddingChunker reports the padded length for each chunk returned by a
+// Chunker.
+type PaddingChunker struct {
+	chunker *Chunker
+	padding Padding
+}
+
+// NewPadding returns a PaddingChunker which pads the chunks returned by c
+// according to p.
+func NewPadding(c *Chunker, p Padding) *PaddingChunker {
+	return &PaddingChunker{chunker: c, padding: p}
+}
+
+// Next returns the next chunk and its padded length, see Chunker.Next. The
+// chunk data is not padded, use Pad for this.
+func (p *PaddingChunker) Next(data []byte) (PaddedChunk, error) {
+	c, err := p.chunker.Next(data)
+	if err != nil {
+		return PaddedChunk{}, err
+	}
+
+	return PaddedChunk{Chunk: c, PaddedLength: p.padding.PaddedLength(c)}, nil
+}
+
+const padMarker = 0x80
+
+// Pad appends data to dst followed by a single 0x80 byte and as many zero
+// bytes as needed for the appended data to be paddedLength bytes long. When
+// paddedLength is not larger than len(data), Pad panics.
+func Pad(dst, data []byte, paddedLength uint) []byte {
+	if paddedLength <= uint(len(data)) {
+		panic("padded length too small")
+	}
+
+	dst = append(dst, data...)
+	dst = append(dst, padMarker)
+	for i := uint(len(data)) + 1; i < paddedLength; i++ {
+		dst = append(dst, 0)
+	}
+
+	return dst
+}
+
+// Unpad removes the padding added by Pad and returns the original data. The
+// returned slice shares the underlying array with data.
+func Unpad(data []byte) ([]byte, error) {
+	i := len(data) - 1
+	for i >= 0 && data[i] == 0 {
+		i--
+	}
+
+	if i < 0 || data[i] != padMarker {
+		return nil, errors.New("invalid padding")
+	}
+
+	return data[:i], nil
+}
+
+// PaddingStats describes the storage overhead of a padding policy.
+type PaddingStats struct {
+	Chunks      uint
+	Bytes       uint64
+	PaddedBytes uint64
+}
+
+// Overhead returns the additional storage needed for padding relative to
+// the unpadded size, e.g. 0.05 for five percent.
+func (s PaddingStats) Overhead() float64 {
+	if s.Bytes == 0 {
+		return 0
+	}
+
+	return float64(s.PaddedBytes-s.Bytes) / float64(s.Bytes)
+}
+
+// MeasurePadding reads all chunks from c and returns the storage overhead
+// of padding them according to p.
+func MeasurePadding(c *Chunker, p Padding) (PaddingStats, error) {
+	var stats PaddingStats
+	pc := NewPadding(c, p)
+
+	// the buffer is reused, it grows to the size of the largest chunk
+	var buf []byte
+	for {
+		chunk, err := pc.Next(buf)
+		if err == io.EOF {
+			return stats, nil
+		}
+
+		if err != nil {
+			return stats, err
+		}
+
+		stats.Chunks++
+		stats.Bytes += uint64(chunk.Length)
+		stats.PaddedBytes += uint64(chunk.PaddedLength)
+		buf = chunk.Data[:0]
+	}
+}
@@ -0,0 +1,195 @@
+package chunker
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"testing"
+)
+
+var expPaddingTests = []struct {
+	bits   uint
+	length uint
+	padded uint
+}{
+	{1, 0, 1},
+	{1, 3, 4},
+	{1, 4, 8},
+	{1, 1000, 1024},
+	{0, 1000, 1024},
+	{2, 1000, 1024},
+	{3, 1000, 1024},
+	{4, 1000, 1024},
+	{5, 1000, 1024},
+	{6, 1000, 1008},
+	{8, 1000, 1004},
+	{20, 1000, 1001},
+	{3, 1 << 20, 1<<20 + 1<<18},
+}
+
+func TestExponentialPadding(t *testing.T) {
+	for i, test := range expPaddingTests {
+		p := ExponentialPadding{Bits: test.bits}
+		res := p.PaddedLength(Chunk{Length: test.length})
+		if res != test.padded {
+			t.Errorf("test %d: wrong padded length for %d with %d bits: want %d, got %d",
+				i, test.length, test.bits, test.padded, res)
+		}
+	}
+}
+
+func TestExponentialPaddingBuckets(t *testing.T) {
+	p := ExponentialPadding{Bits: 4}
+	buckets := make(map[uint]struct{})
+	for l := uint(MinSize); l <= MaxSize; l += 997 {
+		padded := p.PaddedLength(Chunk{Length: l})
+		if padded <= l {
+			t.Fatalf("padded length %d for %d is too small", padded, l)
+		}
+
+		if float64(padded-l-1)/float64(l) > 1.0/8 {
+			t.Fatalf("overhead for %d (padded to %d) too large", l, padded)
+		}
+
+		buckets[padded] = struct{}{}
+	}
+
+	// MinSize to MaxSize spans four powers of two with 8 buckets each, plus
+	// the buckets at MaxSize itself
+	if len(buckets) > 4*8+2 {
+		t.Fatalf("too many buckets: %d", len(buckets))
+	}
+}
+
+func TestKeyedPadding(t *testing.T) {
+	p := KeyedPadding{Key: []byte("secret"), MaxPercent: 10}
+	other := KeyedPadding{Key: []byte("other secret"), MaxPercent: 10}
+
+	var differ int
+	for i, l := range []uint{0, 1, 100, 1000, MinSize, MaxSize} {
+		c := Chunk{Length: l, Cut: uint64(i) * 0x1234567}
+		padded := p.PaddedLength(c)
+		if padded <= l || padded > l+1+l/10 {
+			t.Errorf("padded length %d for %d out of range", padded, l)
+		}
+
+		if p.PaddedLength(c) != padded {
+			t.Errorf("padded length for %d is not deterministic", l)
+		}
+
+		if other.PaddedLength(c) != padded {
+			differ++
+		}
+	}
+
+	if differ == 0 {
+		t.Errorf("padded lengths do not depend on the key")
+	}
+}
+
+func TestPadUnpad(t *testing.T) {
+	for _, data := range [][]byte{
+		nil,
+		{0},
+		{0x80},
+		{1, 2, 3, 0, 0},
+		getRandom(5, 1024),
+	} {
+		for _, extra := range []uint{1, 2, 100} {
+			padded := Pad(nil, data, uint(len(data))+extra)
+			if uint(len(padded)) != uint(len(data))+extra {
+				t.Fatalf("wrong padded length: want %d, got %d", uint(len(data))+extra, len(padded))
+			}
+
+			res, err := Unpad(padded)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(res, data) {
+				t.Fatalf("wrong data returned: want %02x, got %02x", data, res)
+			}
+		}
+	}
+
+	for _, data := range [][]byte{nil, {0, 0}, {1, 2, 3}, {0x80, 1}} {
+		_, err := Unpad(data)
+		if err == nil {
+			t.Errorf("invalid padding %02x not detected", data)
+		}
+	}
+}
+
+func TestPaddingChunker(t *testing.T) {
+	buf := getRandom(23, 32*1024*1024)
+	p := ExponentialPadding{Bits: 3}
+	pc := NewPadding(New(bytes.NewReader(buf), testPol), p)
+
+	for i := 0; ; i++ {
+		c, err := pc.Next(nil)
+		if err == io.EOF {
+			if i != len(chunks1) {
+				t.Fatalf("wrong number of chunks: want %d, got %d", len(chunks1), i)
+			}
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if c.Length != chunks1[i].Length {
+			t.Fatalf("wrong length for chunk %d: want %d, got %d", i, chunks1[i].Length, c.Length)
+		}
+
+		if c.PaddedLength != p.PaddedLength(c.Chunk) {
+			t.Fatalf("wrong padded length for chunk %d", i)
+		}
+	}
+}
+
+func TestMeasurePadding(t *testing.T) {
+	buf := getRandom(23, 32*1024*1024)
+
+	stats, err := MeasurePadding(New(bytes.NewReader(buf), testPol), ExponentialPadding{Bits: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Chunks != uint(len(chunks1)) {
+		t.Errorf("wrong number of chunks: want %d, got %d", len(chunks1), stats.Chunks)
+	}
+
+	if stats.Bytes != uint64(len(buf)) {
+		t.Errorf("wrong number of bytes: want %d, got %d", len(buf), stats.Bytes)
+	}
+
+	if stats.Overhead() <= 0 || stats.Overhead() > 0.25 {
+		t.Errorf("unexpected overhead %v", stats.Overhead())
+	}
+
+	t.Logf("%d chunks, overhead %.2f%%", stats.Chunks, 100*stats.Overhead())
+}
+
+func TestMeasurePaddingSmall(t *testing.T) {
+	buf := getRandom(23, 1024)
+	ch := New(bytes.NewReader(buf), testPol, WithBuffer(make([]byte, 4096)))
+
+	// the memory needed depends on the size of the chunks, not on MaxSize
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	stats, err := MeasurePadding(ch, ExponentialPadding{Bits: 3})
+	runtime.ReadMemStats(&after)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Chunks != 1 || stats.Bytes != uint64(len(buf)) {
+		t.Fatalf("wrong stats: %d chunks, %d bytes", stats.Chunks, stats.Bytes)
+	}
+
+	if n := after.TotalAlloc - before.TotalAlloc; n > 64*1024 {
+		t.Fatalf("%d bytes allocated for a %d byte input", n, len(buf))
+	}
+}
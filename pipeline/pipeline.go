@@ -0,0 +1,161 @@
+// Package pipeline processes the chunks of a chunker.Chunker concurrently:
+// the chunks are read in order, passed to a stage function by a number of
+// workers, and the results are delivered in the original order of the chunks.
+// The number of chunks in flight is bounded, so memory use does not depend on
+// the size of the data, and the chunk buffers are reused.
+package pipeline
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/restic/chunker"
+)
+
+// Stage processes a chunk, e.g. hashes, compresses or encrypts it. It is
+// called concurrently by several workers. The data of the chunk is reused
+// after the result has been delivered, so it must not be retained.
+type Stage func(ctx context.Context, chunk chunker.Chunk) (interface{}, error)
+
+// Result is the result of a Stage for a chunk. The data of the chunk is only
+// valid until the function receiving the result returns.
+type Result struct {
+	Chunk chunker.Chunk
+	Value interface{}
+}
+
+// job is a chunk in flight, seq is its index.
+type job struct {
+	seq   int
+	chunk chunker.Chunk
+	value interface{}
+	err   error
+}
+
+// Run reads all chunks from ch and calls stage for each of them with the
+// given number of workers. The results are passed to fn in the order of the
+// chunks. At most twice as many chunks as workers are in flight: when the
+// results of the next chunks are not delivered yet, no more chunks are read.
+//
+// Run stops at the first error returned by ch, stage or fn, and returns it.
+// The context passed to stage is cancelled when an error occurs or ctx is
+// cancelled. The results of all chunks read before an error of ch are
+// delivered before the error is returned.
+func Run(ctx context.Context, ch *chunker.Chunker, workers int, stage Stage, fn func(Result) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	inflight := 2 * workers
+	tokens := make(chan struct{}, inflight)
+	free := make(chan []byte, inflight)
+	jobs := make(chan job)
+
+	// no send blocks since the number of jobs is bounded by the tokens
+	results := make(chan job, inflight)
+	readErr := make(chan error, 1)
+
+	go func() {
+		defer close(jobs)
+		readErr <- read(ctx, ch, tokens, free, jobs)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				j.value, j.err = stage(ctx, j.chunk)
+				results <- j
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// deliver the results in order, later results wait in pending
+	var err error
+	pending := make(map[int]job, inflight)
+	next := 0
+	for j := range results {
+		if err != nil {
+			continue
+		}
+
+		if j.err != nil {
+			err = j.err
+			cancel()
+			continue
+		}
+
+		pending[j.seq] = j
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			if ferr := fn(Result{Chunk: r.chunk, Value: r.value}); ferr != nil {
+				err = ferr
+				cancel()
+				break
+			}
+
+			// recycle the buffer and allow the next chunk to be read
+			select {
+			case free <- r.chunk.Data[:0]:
+			default:
+			}
+			<-tokens
+		}
+	}
+
+	if rerr := <-readErr; err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+// read reads the chunks from ch and sends them to jobs, a token is needed for
+// each chunk. It returns nil when all chunks have been read.
+func read(ctx context.Context, ch *chunker.Chunker, tokens chan struct{}, free chan []byte, jobs chan<- job) error {
+	for seq := 0; ; seq++ {
+		select {
+		case tokens <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		var buf []byte
+		select {
+		case buf = <-free:
+		default:
+		}
+
+		chunk, err := ch.NextContext(ctx, buf)
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		select {
+		case jobs <- job{seq: seq, chunk: chunk}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
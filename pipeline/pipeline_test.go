@@ -0,0 +1,234 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restic/chunker"
+)
+
+const testPol = chunker.Pol(0x3DA3358B4DC173)
+
+func random(seed int64, n int) []byte {
+	buf := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(buf)
+	return buf
+}
+
+func newTestChunker(rd io.Reader) *chunker.Chunker {
+	return chunker.New(rd, testPol, chunker.WithBoundaries(16*1024, 256*1024), chunker.WithAverageBits(15))
+}
+
+// hashes returns the hashes of the chunks of data.
+func hashes(t *testing.T, data []byte) [][32]byte {
+	ch := newTestChunker(bytes.NewReader(data))
+
+	var res [][32]byte
+	for {
+		c, err := ch.Next(nil)
+		if err == io.EOF {
+			return res
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res = append(res, sha256.Sum256(c.Data))
+	}
+}
+
+// hashStage returns the hash of a chunk after a random delay.
+func hashStage(ctx context.Context, chunk chunker.Chunk) (interface{}, error) {
+	time.Sleep(time.Duration(rand.Intn(1000)) * time.Microsecond)
+	return sha256.Sum256(chunk.Data), nil
+}
+
+func TestRun(t *testing.T) {
+	data := random(1, 16*1024*1024)
+	want := hashes(t, data)
+
+	for _, workers := range []int{0, 1, 4, 16} {
+		var mu sync.Mutex
+		var inflight, maxInflight int
+
+		stage := func(ctx context.Context, chunk chunker.Chunk) (interface{}, error) {
+			mu.Lock()
+			inflight++
+			if inflight > maxInflight {
+				maxInflight = inflight
+			}
+			mu.Unlock()
+
+			return hashStage(ctx, chunk)
+		}
+
+		var got [][32]byte
+		pos := uint(0)
+		err := Run(context.Background(), newTestChunker(bytes.NewReader(data)), workers, stage, func(r Result) error {
+			if r.Chunk.Start != pos || !bytes.Equal(r.Chunk.Data, data[pos:pos+r.Chunk.Length]) {
+				t.Fatalf("wrong chunk at %d: start %d", pos, r.Chunk.Start)
+			}
+			pos += r.Chunk.Length
+
+			mu.Lock()
+			inflight--
+			mu.Unlock()
+
+			got = append(got, r.Value.([32]byte))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got) != len(want) {
+			t.Fatalf("workers %d: wrong number of results: want %d, got %d", workers, len(want), len(got))
+		}
+
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("workers %d: wrong result %d", workers, i)
+			}
+		}
+
+		limit := 2 * workers
+		if limit < 2 {
+			limit = 2
+		}
+
+		if maxInflight > limit {
+			t.Errorf("workers %d: %d chunks in flight, want at most %d", workers, maxInflight, limit)
+		}
+	}
+}
+
+func TestRunStageError(t *testing.T) {
+	data := random(2, 8*1024*1024)
+	errStage := errors.New("stage failed")
+
+	var started int
+	var mu sync.Mutex
+	stage := func(ctx context.Context, chunk chunker.Chunk) (interface{}, error) {
+		mu.Lock()
+		started++
+		mu.Unlock()
+
+		if chunk.Start > 1024*1024 {
+			return nil, errStage
+		}
+		return hashStage(ctx, chunk)
+	}
+
+	err := Run(context.Background(), newTestChunker(bytes.NewReader(data)), 4, stage, func(r Result) error {
+		if r.Chunk.Start > 1024*1024 {
+			t.Fatalf("result delivered for failed chunk at %d", r.Chunk.Start)
+		}
+		return nil
+	})
+	if err != errStage {
+		t.Fatalf("wrong error returned: %v", err)
+	}
+
+	if started > 100 {
+		t.Errorf("processing continued after the error: %d chunks", started)
+	}
+}
+
+func TestRunResultError(t *testing.T) {
+	data := random(3, 8*1024*1024)
+	errResult := errors.New("result failed")
+
+	var results int
+	err := Run(context.Background(), newTestChunker(bytes.NewReader(data)), 4, hashStage, func(r Result) error {
+		results++
+		if results == 5 {
+			return errResult
+		}
+		return nil
+	})
+	if err != errResult || results != 5 {
+		t.Fatalf("wrong error returned after %d results: %v", results, err)
+	}
+}
+
+// failingReader returns an error after the data.
+type failingReader struct {
+	rd  io.Reader
+	err error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.rd.Read(p)
+	if err == io.EOF {
+		return n, r.err
+	}
+	return n, err
+}
+
+func TestRunReadError(t *testing.T) {
+	data := random(4, 8*1024*1024)
+	want := hashes(t, data)
+	errRead := errors.New("read failed")
+
+	var got int
+	rd := &failingReader{rd: bytes.NewReader(data), err: errRead}
+	err := Run(context.Background(), newTestChunker(rd), 4, hashStage, func(r Result) error {
+		if r.Value.([32]byte) != want[got] {
+			t.Fatalf("wrong result %d", got)
+		}
+		got++
+		return nil
+	})
+	if err != errRead {
+		t.Fatalf("wrong error returned: %v", err)
+	}
+
+	// all complete chunks read before the error are delivered
+	if got < len(want)-1 {
+		t.Fatalf("only %d of %d results delivered", got, len(want))
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	data := random(5, 8*1024*1024)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var results int
+	err := Run(ctx, newTestChunker(bytes.NewReader(data)), 4, hashStage, func(r Result) error {
+		results++
+		if results == 3 {
+			cancel()
+		}
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("wrong error returned: %v", err)
+	}
+}
+
+func BenchmarkRun(b *testing.B) {
+	data := random(6, 32*1024*1024)
+	stage := func(ctx context.Context, chunk chunker.Chunk) (interface{}, error) {
+		return sha256.Sum256(chunk.Data), nil
+	}
+
+	b.ResetTimer()
+	b.SetBytes(int64(len(data)))
+
+	for i := 0; i < b.N; i++ {
+		ch := chunker.New(bytes.NewReader(data), testPol)
+		err := Run(context.Background(), ch, 4, stage, func(r Result) error { return nil })
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
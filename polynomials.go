@@ -1,13 +1,20 @@
 package chunker
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"hash"
 	"io"
 	"math/bits"
 	"strconv"
+	"strings"
 )
 
 // Pol is a polynomial from F_2[X].
@@ -32,20 +39,55 @@ func (x Pol) Mul(y Pol) Pol {
 		return x.mul2()
 	}
 
-	var res Pol
-	for i := 0; i <= y.Deg(); i++ {
-		if (y & (1 << uint(i))) > 0 {
-			res = res.Add(x << uint(i))
-		}
-	}
-
-	if res.Div(y) != x {
+	res, overflow := x.MulOverflow(y)
+	if overflow {
 		panic("multiplication would overflow uint64")
 	}
 
 	return res
 }
 
+// MulOverflow returns x*y and reports whether the product overflows uint64.
+// In this case only the lower 64 coefficients of the product are returned.
+func (x Pol) MulOverflow(y Pol) (Pol, bool) {
+	hi, lo := x.MulFull(y)
+	return lo, hi != 0
+}
+
+// MulFull returns the carry-less product x*y, which has up to 127
+// coefficients, as the upper (x^64 to x^127) and lower (1 to x^63) halves.
+func (x Pol) MulFull(y Pol) (hi, lo Pol) {
+	if x == 0 || y == 0 {
+		return 0, 0
+	}
+
+	// precompute x*n for all polynomials n of degree below four, these
+	// products have at most 67 coefficients
+	var thi, tlo [16]uint64
+	a := uint64(x)
+	tlo[1] = a
+	for i := 2; i < 16; i += 2 {
+		thi[i] = thi[i/2]<<1 | tlo[i/2]>>63
+		tlo[i] = tlo[i/2] << 1
+		thi[i+1] = thi[i]
+		tlo[i+1] = tlo[i] ^ a
+	}
+
+	// process y four bits at a time, starting with the highest non-zero nibble
+	b := uint64(y)
+	var h, l uint64
+	for s := (bits.Len64(b) - 1) &^ 3; s >= 0; s -= 4 {
+		h = h<<4 | l>>60
+		l <<= 4
+
+		n := (b >> uint(s)) & 0xf
+		h ^= thi[n]
+		l ^= tlo[n]
+	}
+
+	return Pol(h), Pol(l)
+}
+
 // 2*x.
 func (x Pol) mul2() Pol {
 	if x&(1<<63) != 0 {
@@ -142,6 +184,13 @@ func RandomPolynomial() (Pol, error) {
 	return DerivePolynomial(rand.Reader)
 }
 
+// RandomPolynomialDegree returns a new random irreducible polynomial of
+// degree deg using the default System CSPRNG as source. It is equivalent to
+// calling DerivePolynomialDegree(rand.Reader, deg).
+func RandomPolynomialDegree(deg int) (Pol, error) {
+	return DerivePolynomialDegree(rand.Reader, deg)
+}
+
 // DerivePolynomial returns an irreducible polynomial of degree 53
 // (largest prime number below 64-8) by reading bytes from source.
 // There are (2^53-2/53) irreducible polynomials of degree 53 in
@@ -149,6 +198,40 @@ func RandomPolynomial() (Pol, error) {
 // Polynomials", page 4. If no polynomial could be found in one
 // million tries, an error is returned.
 func DerivePolynomial(source io.Reader) (Pol, error) {
+	return DerivePolynomialDegree(source, 53)
+}
+
+// minPolDegree and maxPolDegree are the lowest and highest degree of a
+// polynomial the chunker supports. The chunker shifts the digest by deg-8
+// bits to find the index into the reduction table, the upper bound allows
+// the compiler to optimize this shift.
+const (
+	minPolDegree = 8
+	maxPolDegree = 53
+)
+
+// checkDegree returns an error if the chunker does not support polynomials of
+// degree deg.
+func checkDegree(deg int) error {
+	if deg < minPolDegree || deg > maxPolDegree {
+		return fmt.Errorf("polynomial degree %d not supported, must be between %d and %d",
+			deg, minPolDegree, maxPolDegree)
+	}
+
+	return nil
+}
+
+// DerivePolynomialDegree returns an irreducible polynomial of degree deg by
+// reading bytes from source, deg must be between 8 and 53. Each candidate is
+// read from 8 bytes in little-endian byte order, bits above deg are cleared
+// and bits deg and 0 are set. For deg = 53 the result is the same as for
+// DerivePolynomial. If no polynomial could be found in one million tries, an
+// error is returned.
+func DerivePolynomialDegree(source io.Reader, deg int) (Pol, error) {
+	if err := checkDegree(deg); err != nil {
+		return 0, err
+	}
+
 	for i := 0; i < randPolMaxTries; i++ {
 		var f Pol
 
@@ -158,12 +241,7 @@ func DerivePolynomial(source io.Reader) (Pol, error) {
 			return 0, err
 		}
 
-		// mask away bits above bit 53
-		f &= Pol((1 << 54) - 1)
-
-		// set highest and lowest bit so that the degree is 53 and the
-		// polynomial is not trivially reducible
-		f |= (1 << 53) | 1
+		f = polCandidate(f, deg)
 
 		// test if f is irreducible
 		if f.Irreducible() {
@@ -176,6 +254,90 @@ func DerivePolynomial(source io.Reader) (Pol, error) {
 	return 0, errors.New("unable to find new random irreducible polynomial")
 }
 
+// polCandidate turns 64 random bits into a candidate polynomial of degree deg.
+func polCandidate(f Pol, deg int) Pol {
+	// mask away bits above bit deg
+	f &= Pol((1 << uint(deg+1)) - 1)
+
+	// set highest and lowest bit so that the degree is deg and the
+	// polynomial is not trivially reducible
+	f |= (1 << uint(deg)) | 1
+
+	return f
+}
+
+// polKeyInfo is the HKDF info prefix for PolynomialFromKey, the version
+// number must be increased when the derivation changes.
+const polKeyInfo = "restic/chunker polynomial v1"
+
+// PolynomialFromKey deterministically derives an irreducible polynomial of
+// degree 53 from key, which must be a uniformly random secret of at least 32
+// bytes (e.g. a repository master key). The context separates polynomials
+// derived from the same key for different purposes.
+//
+// The derivation (version 1) is fixed so that other implementations can
+// reproduce it: HKDF-Expand (RFC 5869) with SHA-256 is run with key as the
+// pseudorandom key and the info string "restic/chunker polynomial v1", a zero
+// byte and context. The output is split into 8 byte little-endian candidates,
+// for each candidate bits 54 to 63 are cleared and bits 53 and 0 are set. The
+// first candidate for which Irreducible returns true is returned. If none of
+// the 1020 candidates the expansion yields is irreducible, an error is
+// returned. About 3.8% of the candidates are irreducible, so the probability
+// for this is about 2^-56.
+func PolynomialFromKey(key, context []byte) (Pol, error) {
+	if len(key) < sha256.Size {
+		return 0, errors.New("key for polynomial derivation is too short")
+	}
+
+	info := make([]byte, 0, len(polKeyInfo)+1+len(context))
+	info = append(info, polKeyInfo...)
+	info = append(info, 0)
+	info = append(info, context...)
+
+	return DerivePolynomial(newHKDFExpand(key, info))
+}
+
+// hkdfExpand implements the expand step of HKDF (RFC 5869) with SHA-256 as
+// an io.Reader.
+type hkdfExpand struct {
+	mac     hash.Hash
+	info    []byte
+	counter byte
+	prev    []byte
+	buf     []byte
+}
+
+func newHKDFExpand(prk, info []byte) *hkdfExpand {
+	return &hkdfExpand{mac: hmac.New(sha256.New, prk), info: info}
+}
+
+// Read fills p with the next bytes of the expansion, at most 255*32 bytes can
+// be read in total, afterwards io.EOF is returned.
+func (h *hkdfExpand) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		if len(h.buf) == 0 {
+			if h.counter == 255 {
+				return n, io.EOF
+			}
+			h.counter++
+
+			// T(i) = HMAC-Hash(PRK, T(i-1) | info | i)
+			h.mac.Reset()
+			_, _ = h.mac.Write(h.prev)
+			_, _ = h.mac.Write(h.info)
+			_, _ = h.mac.Write([]byte{h.counter})
+			h.prev = h.mac.Sum(h.prev[:0])
+			h.buf = h.prev
+		}
+
+		c := copy(p[n:], h.buf)
+		h.buf = h.buf[c:]
+		n += c
+	}
+
+	return n, nil
+}
+
 // GCD computes the Greatest Common Divisor x and f.
 func (x Pol) GCD(f Pol) Pol {
 	if f == 0 {
@@ -199,8 +361,16 @@ func (x Pol) GCD(f Pol) Pol {
 // For details see "Tests and Constructions of Irreducible Polynomials over
 // Finite Fields".
 func (x Pol) Irreducible() bool {
+	if x.Deg() < 2 {
+		return true
+	}
+
+	// compute x^(2^i) mod x incrementally by repeated squaring
+	b := newBarrett(x)
+	h := Pol(2)
 	for i := 1; i <= x.Deg()/2; i++ {
-		if x.GCD(qp(uint(i), x)) != 1 {
+		h = b.mulMod(h, h)
+		if x.GCD(h.Add(2)) != 1 {
 			return false
 		}
 	}
@@ -214,39 +384,111 @@ func (x Pol) MulMod(f, g Pol) Pol {
 		return 0
 	}
 
-	var res Pol
-	for i := 0; i <= f.Deg(); i++ {
-		if (f & (1 << uint(i))) > 0 {
-			a := x
-			for j := 0; j < i; j++ {
-				a = a.Mul(2).Mod(g)
-			}
-			res = res.Add(a).Mod(g)
-		}
-	}
+	b := newBarrett(g)
+	return b.mulMod(x.Mod(g), f.Mod(g))
+}
 
-	return res
+// ExpMod computes x^e mod g by repeated squaring.
+func (x Pol) ExpMod(e uint64, g Pol) Pol {
+	b := newBarrett(g)
+	return b.expMod(x.Mod(g), e)
 }
 
 // qp computes the polynomial (x^(2^p)-x) mod g. This is needed for the
 // reducibility test.
 func qp(p uint, g Pol) Pol {
-	num := (1 << p)
-	i := 1
+	b := newBarrett(g)
 
 	// start with x
-	res := Pol(2)
+	res := Pol(2).Mod(g)
 
-	for i < num {
+	for i := uint(0); i < p; i++ {
 		// repeatedly square res
-		res = res.MulMod(res, g)
-		i *= 2
+		res = b.mulMod(res, res)
 	}
 
 	// add x
 	return res.Add(2).Mod(g)
 }
 
+// barrett reduces products modulo a fixed polynomial g using Barrett
+// reduction, which replaces the division by g with two multiplications.
+type barrett struct {
+	g  Pol
+	d  uint
+	mu Pol // x^(2d) / g
+}
+
+func newBarrett(g Pol) barrett {
+	if g == 0 {
+		panic("division by zero")
+	}
+
+	d := uint(g.Deg())
+	if d == 0 {
+		return barrett{g: g}
+	}
+
+	return barrett{g: g, d: d, mu: divXn(2*d, g)}
+}
+
+// divXn returns x^n / g. The quotient must fit into 64 bits, i.e.
+// n - deg(g) < 64, and g must not be constant.
+func divXn(n uint, g Pol) Pol {
+	d := uint(g.Deg())
+
+	var q, r Pol
+	for i := int(n); i >= 0; i-- {
+		r <<= 1
+		if uint(i) == n {
+			r |= 1
+		}
+
+		if r&(1<<d) != 0 {
+			r ^= g
+			q |= 1 << uint(i)
+		}
+	}
+
+	return q
+}
+
+// mulMod returns x*y mod g, the degrees of x and y must be below deg(g).
+func (b *barrett) mulMod(x, y Pol) Pol {
+	if b.d == 0 {
+		return 0
+	}
+
+	phi, plo := x.MulFull(y)
+
+	// q = ((p / x^d) * mu) / x^d is the quotient p / g, the remainder is
+	// then p - q*g, which only has coefficients below x^d
+	t := (plo >> b.d) | (phi << (64 - b.d))
+	hi, lo := t.MulFull(b.mu)
+	q := (lo >> b.d) | (hi << (64 - b.d))
+	_, qg := q.MulFull(b.g)
+
+	return plo ^ qg
+}
+
+// expMod returns x^e mod g, the degree of x must be below deg(g).
+func (b *barrett) expMod(x Pol, e uint64) Pol {
+	if b.d == 0 {
+		return 0
+	}
+
+	res := Pol(1)
+	for e > 0 {
+		if e&1 == 1 {
+			res = b.mulMod(res, x)
+		}
+		x = b.mulMod(x, x)
+		e >>= 1
+	}
+
+	return res
+}
+
 // MarshalJSON returns the JSON representation of the Pol.
 func (x Pol) MarshalJSON() ([]byte, error) {
 	buf := strconv.AppendUint([]byte{'"'}, uint64(x), 16)
@@ -254,16 +496,131 @@ func (x Pol) MarshalJSON() ([]byte, error) {
 	return buf, nil
 }
 
-// UnmarshalJSON parses a Pol from the JSON data.
+// UnmarshalJSON parses a Pol from the JSON data, the string may be in any
+// form accepted by ParsePol.
 func (x *Pol) UnmarshalJSON(data []byte) error {
-	if len(data) < 2 {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
 		return errors.New("invalid string for polynomial")
 	}
-	n, err := strconv.ParseUint(string(data[1:len(data)-1]), 16, 64)
+
+	p, err := ParsePol(s)
 	if err != nil {
 		return err
 	}
-	*x = Pol(n)
+	*x = p
 
 	return nil
 }
+
+// ParsePol parses a polynomial from s. Accepted are hexadecimal numbers with
+// or without the prefix "0x" (as returned by String) and the expanded form
+// (as returned by Expand), e.g. "x^53+x^4+1".
+func ParsePol(s string) (Pol, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errors.New("empty string for polynomial")
+	}
+
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		return parseHexPol(s[2:])
+	}
+
+	if strings.ContainsAny(s, "xX+^") {
+		return parseExpandedPol(s)
+	}
+
+	return parseHexPol(s)
+}
+
+func parseHexPol(s string) (Pol, error) {
+	n, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid polynomial %q: %v", s, err)
+	}
+
+	return Pol(n), nil
+}
+
+// parseExpandedPol parses a sum of the terms "1", "x" and "x^n".
+func parseExpandedPol(s string) (Pol, error) {
+	if strings.TrimSpace(s) == "0" {
+		return 0, nil
+	}
+
+	var x Pol
+	for _, term := range strings.Split(s, "+") {
+		term = strings.TrimSpace(term)
+
+		var e uint64
+		switch {
+		case term == "1":
+			e = 0
+		case term == "x" || term == "X":
+			e = 1
+		case strings.HasPrefix(term, "x^") || strings.HasPrefix(term, "X^"):
+			var err error
+			e, err = strconv.ParseUint(term[2:], 10, 8)
+			if err != nil || e > 63 {
+				return 0, fmt.Errorf("invalid exponent in term %q", term)
+			}
+		default:
+			return 0, fmt.Errorf("invalid term %q in polynomial", term)
+		}
+
+		if x&(1<<e) != 0 {
+			return 0, fmt.Errorf("duplicate term %q in polynomial", term)
+		}
+		x |= 1 << e
+	}
+
+	return x, nil
+}
+
+// MarshalText returns the hexadecimal representation of the Pol as returned
+// by String.
+func (x Pol) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText parses a Pol in any form accepted by ParsePol.
+func (x *Pol) UnmarshalText(text []byte) error {
+	p, err := ParsePol(string(text))
+	if err != nil {
+		return err
+	}
+	*x = p
+
+	return nil
+}
+
+var _ flag.Value = new(Pol)
+
+// Set parses a Pol in any form accepted by ParsePol, so that a *Pol can be
+// used as a flag.Value.
+func (x *Pol) Set(s string) error {
+	return x.UnmarshalText([]byte(s))
+}
+
+// Value returns the Pol as int64 for storing it in a database, polynomials
+// of degree 63 are stored as negative numbers.
+func (x Pol) Value() (driver.Value, error) {
+	return int64(x), nil
+}
+
+// Scan reads a Pol from a database value, which must be an integer or a
+// string in any form accepted by ParsePol.
+func (x *Pol) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case int64:
+		*x = Pol(uint64(v))
+		return nil
+	case string:
+		return x.UnmarshalText([]byte(v))
+	case []byte:
+		return x.UnmarshalText(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Pol", src)
+	}
+}
@@ -1,6 +1,13 @@
 package chunker
 
 import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"math/rand"
 	"strconv"
 	"testing"
 )
@@ -257,6 +264,71 @@ func TestRandomPolynomial(t *testing.T) {
 	}
 }
 
+func TestHKDFExpand(t *testing.T) {
+	// RFC 5869, test case 1
+	prk, _ := hex.DecodeString("077709362c2e32df0ddc3f0dc47bba6390b6c73bb50f9c3122ec844ad7c2b3e5")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	okm, _ := hex.DecodeString("3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865")
+
+	buf := make([]byte, len(okm))
+	_, err := io.ReadFull(newHKDFExpand(prk, info), buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf, okm) {
+		t.Fatalf("wrong output: want %02x, got %02x", okm, buf)
+	}
+
+	n, err := io.Copy(ioutil.Discard, newHKDFExpand(prk, info))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 255*32 {
+		t.Fatalf("wrong maximal output length: %d", n)
+	}
+}
+
+// test vectors for PolynomialFromKey, version 1
+var polFromKeyTests = []struct {
+	key     string
+	context string
+	pol     Pol
+}{
+	{"000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "", 0x2989fa00c61183},
+	{"000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "chunker", 0x28e7b201e4b3cd},
+	{"000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "restic repository 5e2f", 0x251a6a4013f60d},
+	{"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", "", 0x34a663c5670bbd},
+}
+
+func TestPolynomialFromKey(t *testing.T) {
+	for i, test := range polFromKeyTests {
+		key, err := hex.DecodeString(test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pol, err := PolynomialFromKey(key, []byte(test.context))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pol != test.pol {
+			t.Errorf("test %d: wrong polynomial, want %v, got %v", i, test.pol, pol)
+		}
+
+		if pol.Deg() != 53 || !pol.Irreducible() {
+			t.Errorf("test %d: polynomial %v is not irreducible of degree 53", i, pol)
+		}
+	}
+
+	_, err := PolynomialFromKey(make([]byte, 16), nil)
+	if err == nil {
+		t.Fatal("short key not rejected")
+	}
+}
+
 func BenchmarkRandomPolynomial(t *testing.B) {
 	for i := 0; i < t.N; i++ {
 		_, err := RandomPolynomial()
@@ -425,3 +497,302 @@ func TestPolMulMod(t *testing.T) {
 		}
 	}
 }
+
+// naiveMulFull computes x*y bit by bit.
+func naiveMulFull(x, y Pol) (hi, lo Pol) {
+	for i := uint(0); i < 64; i++ {
+		if y&(1<<i) == 0 {
+			continue
+		}
+
+		lo ^= x << i
+		if i > 0 {
+			hi ^= x >> (64 - i)
+		}
+	}
+
+	return hi, lo
+}
+
+// naiveMulMod computes x*f mod g by shifting and reducing bit by bit.
+func naiveMulMod(x, f, g Pol) Pol {
+	var res Pol
+	a := x.Mod(g)
+	for i := 0; i <= f.Deg(); i++ {
+		if f&(1<<uint(i)) != 0 {
+			res ^= a
+		}
+		a = (a << 1).Mod(g)
+	}
+
+	return res.Mod(g)
+}
+
+func TestPolMulFull(t *testing.T) {
+	rnd := rand.New(rand.NewSource(23))
+	for i := 0; i < 10000; i++ {
+		x := Pol(rnd.Uint64() >> uint(rnd.Intn(64)))
+		y := Pol(rnd.Uint64() >> uint(rnd.Intn(64)))
+
+		hi, lo := x.MulFull(y)
+		whi, wlo := naiveMulFull(x, y)
+		if hi != whi || lo != wlo {
+			t.Fatalf("MulFull(%v, %v): want %v %v, got %v %v", x, y, whi, wlo, hi, lo)
+		}
+
+		res, overflow := x.MulOverflow(y)
+		if res != wlo || overflow != (whi != 0) {
+			t.Fatalf("MulOverflow(%v, %v): want %v %v, got %v %v", x, y, wlo, whi != 0, res, overflow)
+		}
+	}
+}
+
+func TestPolMulOverflowResult(t *testing.T) {
+	x := Pol(1 << 63)
+	res, overflow := x.MulOverflow(3)
+	if !overflow {
+		t.Fatal("overflow not detected")
+	}
+
+	if res != 1<<63 {
+		t.Fatalf("wrong lower half: %v", res)
+	}
+}
+
+func TestPolMulModRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(23))
+	for i := 0; i < 10000; i++ {
+		x := Pol(rnd.Uint64())
+		f := Pol(rnd.Uint64() >> uint(rnd.Intn(64)))
+		g := Pol(rnd.Uint64()>>uint(rnd.Intn(64))) | 1
+
+		res := x.MulMod(f, g)
+		want := naiveMulMod(x, f, g)
+		if res != want {
+			t.Fatalf("MulMod(%v, %v, %v): want %v, got %v", x, f, g, want, res)
+		}
+	}
+}
+
+func TestPolExpMod(t *testing.T) {
+	rnd := rand.New(rand.NewSource(23))
+	for i := 0; i < 100; i++ {
+		x := Pol(rnd.Uint64())
+		g := Pol(rnd.Uint64()>>uint(rnd.Intn(60))) | 1
+		e := uint64(rnd.Intn(300))
+
+		want := Pol(1).Mod(g)
+		for j := uint64(0); j < e; j++ {
+			want = want.MulMod(x, g)
+		}
+
+		res := x.ExpMod(e, g)
+		if res != want {
+			t.Fatalf("ExpMod(%v, %v, %v): want %v, got %v", x, e, g, want, res)
+		}
+	}
+
+	// x^(2^53-1) = 1 mod f for all irreducible f of degree 53
+	if res := Pol(2).ExpMod(1<<53-1, testPol); res != 1 {
+		t.Fatalf("wrong result %v", res)
+	}
+}
+
+func BenchmarkPolMulFull(b *testing.B) {
+	f := Pol(0x2482734cacca49)
+	g := Pol(0x3af4b284899)
+
+	var sum Pol
+	for i := 0; i < b.N; i++ {
+		hi, lo := f.MulFull(g)
+		sum ^= hi ^ lo
+	}
+	b.Log("xor of products:", sum)
+}
+
+func BenchmarkPolMulMod(b *testing.B) {
+	f := Pol(0x2482734cacca49)
+	g := Pol(0x3af4b284899)
+
+	for i := 0; i < b.N; i++ {
+		g.MulMod(g, f)
+	}
+}
+
+func BenchmarkPolExpMod(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Pol(2).ExpMod(1<<53-1, testPol)
+	}
+}
+
+var parsePolTests = []struct {
+	s   string
+	pol Pol
+}{
+	{"0x3DA3358B4DC173", 0x3DA3358B4DC173},
+	{"0X3da3358b4dc173", 0x3DA3358B4DC173},
+	{"3da3358b4dc173", 0x3DA3358B4DC173},
+	{" 0x11b ", 0x11b},
+	{"0", 0},
+	{"1", 1},
+	{"x", 2},
+	{"x^8+x^4+x^3+x+1", 0x11b},
+	{"x^8 + x^4 + x^3 + x^1 + x^0", 0x11b},
+	{"x^53+x^4+1", 1<<53 | 1<<4 | 1},
+	{"x^63", 1 << 63},
+}
+
+func TestParsePol(t *testing.T) {
+	for _, test := range parsePolTests {
+		p, err := ParsePol(test.s)
+		if err != nil {
+			t.Errorf("%q: %v", test.s, err)
+			continue
+		}
+
+		if p != test.pol {
+			t.Errorf("%q: wrong polynomial: want %v, got %v", test.s, test.pol, p)
+		}
+	}
+
+	for _, s := range []string{"", "0x", "foo", "x^64", "x^-1", "x^2+x^2", "x^3+", "2x", "0x10000000000000000"} {
+		if _, err := ParsePol(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestParsePolRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(23))
+	for i := 0; i < 1000; i++ {
+		x := Pol(rnd.Uint64() >> uint(rnd.Intn(64)))
+
+		for _, s := range []string{x.String(), x.Expand(), strconv.FormatUint(uint64(x), 16)} {
+			p, err := ParsePol(s)
+			if err != nil {
+				t.Fatalf("%q: %v", s, err)
+			}
+
+			if p != x {
+				t.Fatalf("%q: wrong polynomial: want %v, got %v", s, x, p)
+			}
+		}
+	}
+}
+
+func TestPolMarshal(t *testing.T) {
+	for _, x := range []Pol{0, 1, testPol, 1<<63 | 1} {
+		// JSON
+		buf, err := json.Marshal(x)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var p Pol
+		err = json.Unmarshal(buf, &p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p != x {
+			t.Errorf("JSON %s: wrong polynomial: want %v, got %v", buf, x, p)
+		}
+
+		// text
+		text, err := x.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p = 0
+		err = p.UnmarshalText(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p != x {
+			t.Errorf("text %s: wrong polynomial: want %v, got %v", text, x, p)
+		}
+
+		// database
+		v, err := x.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p = 0
+		err = p.Scan(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p != x {
+			t.Errorf("database value %v: wrong polynomial: want %v, got %v", v, x, p)
+		}
+	}
+}
+
+func TestPolUnmarshalJSON(t *testing.T) {
+	for _, s := range []string{`"3da3358b4dc173"`, `"0x3da3358b4dc173"`,
+		`"x^53+x^52+x^51+x^50+x^48+x^47+x^45+x^41+x^40+x^37+x^36+x^34+x^32+x^31+x^27+x^25+x^24+x^22+x^19+x^18+x^16+x^15+x^14+x^8+x^6+x^5+x^4+x+1"`} {
+		var p Pol
+		err := json.Unmarshal([]byte(s), &p)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+
+		if p != testPol {
+			t.Errorf("%s: wrong polynomial %v", s, p)
+		}
+	}
+
+	for _, s := range []string{`3da3358b4dc173`, `""`, `"foo"`, `"`} {
+		var p Pol
+		if err := json.Unmarshal([]byte(s), &p); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
+
+func TestPolFlag(t *testing.T) {
+	var p Pol
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&p, "pol", "polynomial")
+
+	err := fs.Parse([]string{"-pol", "x^8+x^4+x^3+x+1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p != 0x11b {
+		t.Fatalf("wrong polynomial %v", p)
+	}
+
+	fs.SetOutput(ioutil.Discard)
+	if err := fs.Parse([]string{"-pol", "x^100"}); err == nil {
+		t.Fatal("expected error for invalid polynomial")
+	}
+}
+
+func TestPolScan(t *testing.T) {
+	for _, src := range []interface{}{int64(0x11b), "0x11b", []byte("x^8+x^4+x^3+x+1")} {
+		var p Pol
+		err := p.Scan(src)
+		if err != nil {
+			t.Errorf("%v: %v", src, err)
+			continue
+		}
+
+		if p != 0x11b {
+			t.Errorf("%v: wrong polynomial %v", src, p)
+		}
+	}
+
+	var p Pol
+	for _, src := range []interface{}{nil, 1.5, true} {
+		if err := p.Scan(src); err == nil {
+			t.Errorf("%v: expected error", src)
+		}
+	}
+}
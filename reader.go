@@ -0,0 +1,126 @@
+package chunker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// ErrTailMerge is returned by NextReader for a fixed-size Chunker with
+// TailMerge, the tail can only be merged by Next.
+var ErrTailMerge = errors.New("NextReader does not support TailMerge")
+
+// ChunkHeader describes a chunk returned by NextReader. Length, Cut and Flags
+// are set when the reader of the chunk returns io.EOF.
+type ChunkHeader struct {
+	Start  uint
+	Length uint
+	Cut    uint64
+	Flags  ChunkFlags
+}
+
+// NextReader works like Next, but returns the data of the next chunk
+// incrementally as it is scanned, so the chunk is never held in memory as a
+// whole. An error while reading is returned by the reader, the chunk can be
+// continued by calling Read again.
+//
+// If the reader of the previous chunk has not returned io.EOF, the rest of
+// that chunk is skipped. Next must not be called before the reader has
+// returned io.EOF. For a fixed-size Chunker with TailMerge, ErrTailMerge is
+// returned.
+func (c *Chunker) NextReader() (*ChunkHeader, io.Reader, error) {
+	return c.nextReader(nil)
+}
+
+// NextReaderContext works like NextReader, but ctx is checked like in
+// NextContext by NextReaderContext and by all calls to Read of the reader
+// returned, which return ctx.Err() when it is cancelled. The next call to
+// NextReaderContext skips the rest of the chunk using the new context.
+func (c *Chunker) NextReaderContext(ctx context.Context) (*ChunkHeader, io.Reader, error) {
+	return c.nextReader(ctx)
+}
+
+// nextReader implements NextReader and NextReaderContext, ctx is nil for the
+// former.
+func (c *Chunker) nextReader(ctx context.Context) (*ChunkHeader, io.Reader, error) {
+	if c.fixedSize > 0 && c.fixedTail == TailMerge {
+		return nil, nil, ErrTailMerge
+	}
+
+	if c.current != nil {
+		c.current.ctx = ctx
+		if _, err := io.Copy(ioutil.Discard, c.current); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	r := &chunkReader{
+		c:   c,
+		ctx: ctx,
+		hdr: &ChunkHeader{Start: c.pos},
+	}
+
+	// continue a chunk interrupted by an error
+	if c.partial != nil {
+		r.piece = c.partial
+		r.hdr.Start = c.partialStart
+		c.partial = nil
+	}
+
+	// find out whether there is another chunk
+	if len(r.piece) == 0 {
+		if err := r.scan(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	c.current = r
+	return r.hdr, r, nil
+}
+
+// chunkReader returns the data of a chunk, see NextReader.
+type chunkReader struct {
+	c     *Chunker
+	ctx   context.Context
+	hdr   *ChunkHeader
+	piece []byte
+	end   bool
+}
+
+// scan reads the next piece of the chunk.
+func (r *chunkReader) scan() error {
+	piece, end, err := r.c.scan(r.ctx, r.hdr.Length > 0)
+	if err != nil {
+		return err
+	}
+
+	r.piece = piece
+	if end {
+		r.end = true
+		r.hdr.Cut = r.c.endCut
+		r.hdr.Flags = r.c.endFlags
+	}
+
+	return nil
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.piece) == 0 {
+		if r.end {
+			if r.c.current == r {
+				r.c.current = nil
+			}
+			return 0, io.EOF
+		}
+
+		if err := r.scan(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.piece)
+	r.piece = r.piece[n:]
+	r.hdr.Length += uint(n)
+	return n, nil
+}
@@ -0,0 +1,229 @@
+package chunker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestChunkerNextReader(t *testing.T) {
+	buf := getRandom(23, 32*1024*1024)
+	ch := New(bytes.NewReader(buf), testPol)
+	tmp := make([]byte, 4000)
+
+	pos := uint(0)
+	for i, want := range chunks1 {
+		hdr, rd, err := ch.NextReader()
+		if err != nil {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+
+		if hdr.Start != pos {
+			t.Fatalf("chunk %d: wrong start %d, want %d", i, hdr.Start, pos)
+		}
+
+		h := sha256.New()
+		if _, err := io.CopyBuffer(h, rd, tmp); err != nil {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+
+		if hdr.Length != want.Length || hdr.Cut != want.CutFP || !bytes.Equal(h.Sum(nil), want.Digest) {
+			t.Fatalf("chunk %d: wrong chunk returned: %d/%016x", i, hdr.Length, hdr.Cut)
+		}
+		pos += hdr.Length
+	}
+
+	if _, _, err := ch.NextReader(); err != io.EOF {
+		t.Fatalf("wrong error returned after last chunk: %v", err)
+	}
+}
+
+func TestChunkerNextReaderSkip(t *testing.T) {
+	buf := getRandom(23, 32*1024*1024)
+	ch := New(bytes.NewReader(buf), testPol)
+
+	var prev *ChunkHeader
+	for i := range chunks1 {
+		hdr, rd, err := ch.NextReader()
+		if err != nil {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+
+		// the previous chunk has been skipped
+		if prev != nil && hdr.Start != prev.Start+prev.Length {
+			t.Fatalf("chunk %d: wrong start %d", i, hdr.Start)
+		}
+
+		// read only the start of some chunks
+		if i%2 == 1 {
+			p := make([]byte, 100)
+			if _, err := io.ReadFull(rd, p); err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(p, buf[hdr.Start:hdr.Start+100]) {
+				t.Fatalf("chunk %d: wrong data returned", i)
+			}
+		}
+
+		if prev != nil && (prev.Length != chunks1[i-1].Length || prev.Cut != chunks1[i-1].CutFP) {
+			t.Fatalf("chunk %d: wrong chunk returned: %d/%016x", i-1, prev.Length, prev.Cut)
+		}
+		prev = hdr
+	}
+}
+
+func TestChunkerNextReaderErrors(t *testing.T) {
+	buf := getRandom(23, 32*1024*1024)
+	rd := &flakyReader{rd: bytes.NewReader(buf), n: 7}
+	ch := New(rd, testPol, WithBuffer(make([]byte, 100*1024)))
+
+	var failures int
+	for i := 0; i < len(chunks1); {
+		hdr, crd, err := ch.NextReader()
+		if err != nil {
+			if _, ok := err.(temporaryError); !ok {
+				t.Fatal(err)
+			}
+			failures++
+			continue
+		}
+
+		var data []byte
+		p := make([]byte, 32*1024)
+		for {
+			n, err := crd.Read(p)
+			data = append(data, p[:n]...)
+			if err == io.EOF {
+				break
+			}
+
+			if _, ok := err.(temporaryError); ok {
+				failures++
+				continue
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if hdr.Length != chunks1[i].Length || hdr.Cut != chunks1[i].CutFP || !bytes.Equal(hashData(data), chunks1[i].Digest) {
+			t.Fatalf("chunk %d: wrong chunk returned: %d/%016x", i, hdr.Length, hdr.Cut)
+		}
+		i++
+	}
+
+	if failures == 0 {
+		t.Fatal("no errors returned")
+	}
+}
+
+func TestChunkerNextReaderPartial(t *testing.T) {
+	// a chunk interrupted by an error in Next is continued by NextReader
+	buf := getRandom(23, 32*1024*1024)
+	limit := 2*1024*1024 + 17
+	ch := New(&failingReader{data: buf, limit: limit}, testPol, WithBuffer(make([]byte, 64*1024)))
+
+	if _, err := ch.Next(nil); err == nil {
+		t.Fatal("no error returned")
+	}
+	ch.SetReader(bytes.NewReader(buf[limit:]))
+
+	for i, want := range chunks1 {
+		_, rd, err := ch.NextReader()
+		if err != nil {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+
+		data, err := ioutil.ReadAll(rd)
+		if err != nil {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+
+		if !bytes.Equal(hashData(data), want.Digest) {
+			t.Fatalf("chunk %d: wrong data returned", i)
+		}
+	}
+}
+
+func TestChunkerNextReaderTailMerge(t *testing.T) {
+	ch := NewFixed(bytes.NewReader(make([]byte, 1000)), 100, WithFixedTail(TailMerge))
+	if _, _, err := ch.NextReader(); err != ErrTailMerge {
+		t.Fatalf("wrong error returned: %v", err)
+	}
+}
+
+func TestChunkerNextReaderContext(t *testing.T) {
+	buf := getRandom(23, 32*1024*1024)
+	ch := New(bytes.NewReader(buf), testPol, WithBuffer(make([]byte, 64*1024)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := ch.NextReaderContext(ctx); err != context.Canceled {
+		t.Fatalf("wrong error returned: %v", err)
+	}
+
+	pos := uint(0)
+	for i, want := range chunks1 {
+		ctx, cancel := context.WithCancel(context.Background())
+		hdr, rd, err := ch.NextReaderContext(ctx)
+		if err != nil {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+
+		if hdr.Start != pos {
+			t.Fatalf("chunk %d: wrong start %d, want %d", i, hdr.Start, pos)
+		}
+		pos += want.Length
+
+		// read every other chunk completely, cancel the others within the
+		// chunk, their rest is skipped by the next call
+		if i%2 == 0 {
+			data, err := ioutil.ReadAll(rd)
+			if err != nil {
+				t.Fatalf("chunk %d: %v", i, err)
+			}
+
+			if !bytes.Equal(hashData(data), want.Digest) {
+				t.Fatalf("chunk %d: wrong data returned", i)
+			}
+			cancel()
+			continue
+		}
+
+		cancel()
+		if _, err := io.Copy(ioutil.Discard, rd); err != context.Canceled {
+			t.Fatalf("chunk %d: wrong error returned: %v", i, err)
+		}
+	}
+}
+
+func BenchmarkChunkerNextReader(b *testing.B) {
+	data := getRandom(23, 32*1024*1024)
+	buf := make([]byte, 32*1024)
+
+	b.ResetTimer()
+	b.SetBytes(int64(len(data)))
+
+	for i := 0; i < b.N; i++ {
+		ch := New(bytes.NewReader(data), testPol, WithBoundaries(8*1024*1024, 64*1024*1024))
+		for {
+			_, rd, err := ch.NextReader()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			if _, err := io.CopyBuffer(ioutil.Discard, rd, buf); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package chunker
+
+import (
+	"errors"
+	"io"
+	"sort"
+)
+
+// Range is a range of Length bytes starting at Offset.
+type Range struct {
+	Offset uint
+	Length uint
+}
+
+// Rechunk returns the chunks of data of size bytes read from rd, which has
+// been split into the chunks old before the byte ranges in changed were
+// modified. The chunker must be configured with the same polynomial and
+// options as for the previous run, the Data of the chunks in old is ignored
+// and not set in the returned chunks.
+//
+// Since the state of the chunker is reset at each cut, the chunks before a
+// changed range are still valid. Re-chunking starts at the last cut before a
+// changed range and stops as soon as a cut coincides with the start of an
+// old chunk which does not contain changed bytes, only these regions are read
+// from rd. If size differs from the previous size, all bytes after the end of
+// the shorter version are considered changed.
+func Rechunk(rd io.ReaderAt, size uint, old []Chunk, changed []Range, pol Pol, opts ...baseOption) ([]Chunk, error) {
+	var oldSize uint
+	for _, c := range old {
+		if c.Start != oldSize {
+			return nil, errors.New("previous chunks are not contiguous")
+		}
+		oldSize += c.Length
+	}
+
+	r := &rechunker{
+		rd:      rd,
+		size:    size,
+		oldSize: oldSize,
+		old:     old,
+		changed: mergeRanges(changed),
+		bc:      NewBase(pol, opts...),
+	}
+
+	var chunks []Chunk
+	pos := uint(0)
+	for i := 0; pos < size; {
+		if i < len(old) && old[i].Start == pos && r.valid(i) {
+			chunks = append(chunks, Chunk{Start: pos, Length: old[i].Length, Cut: old[i].Cut})
+			pos += old[i].Length
+			i++
+			continue
+		}
+
+		var err error
+		chunks, i, err = r.scan(chunks, pos, i)
+		if err != nil {
+			return nil, err
+		}
+
+		last := chunks[len(chunks)-1]
+		pos = last.Start + last.Length
+	}
+
+	return chunks, nil
+}
+
+// mergeRanges returns the non-empty ranges sorted by offset, overlapping and
+// adjacent ranges are merged.
+func mergeRanges(ranges []Range) []Range {
+	var res []Range
+	for _, r := range ranges {
+		if r.Length > 0 {
+			res = append(res, r)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Offset < res[j].Offset })
+
+	merged := res[:0]
+	for _, r := range res {
+		if n := len(merged); n > 0 && r.Offset <= merged[n-1].Offset+merged[n-1].Length {
+			if end := r.Offset + r.Length; end > merged[n-1].Offset+merged[n-1].Length {
+				merged[n-1].Length = end - merged[n-1].Offset
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+
+	return merged
+}
+
+// rechunker holds the state for Rechunk.
+type rechunker struct {
+	rd            io.ReaderAt
+	size, oldSize uint
+	old           []Chunk
+	changed       []Range
+	bc            *BaseChunker
+	buf           []byte
+}
+
+// valid returns true if the old chunk i is still a chunk of the new data.
+func (r *rechunker) valid(i int) bool {
+	c := r.old[i]
+	end := c.Start + c.Length
+	if end > r.size {
+		return false
+	}
+
+	// the last chunk may not end at a cut but at the end of the data
+	if i == len(r.old)-1 && r.size != r.oldSize {
+		return false
+	}
+
+	// find the first changed range which ends after the start of the chunk
+	j := sort.Search(len(r.changed), func(j int) bool {
+		return r.changed[j].Offset+r.changed[j].Length > c.Start
+	})
+
+	return j == len(r.changed) || r.changed[j].Offset >= end
+}
+
+// scan chunks the data starting at the cut pos and appends the chunks to
+// chunks until a cut coincides with the start of a valid old chunk or the end
+// of the data is reached. The index of the next old chunk to consider is
+// returned.
+func (r *rechunker) scan(chunks []Chunk, pos uint, i int) ([]Chunk, int, error) {
+	if r.buf == nil {
+		r.buf = make([]byte, chunkerBufSize)
+	}
+
+	bc := r.bc
+	bc.reset()
+
+	start := pos
+	for pos < r.size {
+		n := uint(len(r.buf))
+		if n > r.size-pos {
+			n = r.size - pos
+		}
+
+		m, err := r.rd.ReadAt(r.buf[:n], int64(pos))
+		if uint(m) < n {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, 0, err
+		}
+
+		buf := r.buf[:n]
+		for len(buf) > 0 {
+			split, cut := bc.NextSplitPoint(buf)
+			if split == -1 {
+				pos += uint(len(buf))
+				break
+			}
+
+			pos += uint(split)
+			buf = buf[split:]
+			chunks = append(chunks, Chunk{Start: start, Length: pos - start, Cut: cut})
+			start = pos
+
+			for i < len(r.old) && r.old[i].Start < pos {
+				i++
+			}
+
+			if pos == r.size || (i < len(r.old) && r.old[i].Start == pos && r.valid(i)) {
+				return chunks, i, nil
+			}
+		}
+	}
+
+	// the last chunk ends at the end of the data
+	chunks = append(chunks, Chunk{Start: start, Length: pos - start, Cut: bc.digest})
+	return chunks, len(r.old), nil
+}
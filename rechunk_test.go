@@ -0,0 +1,144 @@
+package chunker
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// countingReaderAt counts the bytes read.
+type countingReaderAt struct {
+	rd io.ReaderAt
+	n  uint
+}
+
+func (r *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.rd.ReadAt(p, off)
+	r.n += uint(n)
+	return n, err
+}
+
+var rechunkOpts = []baseOption{WithBaseBoundaries(64*1024, 1024*1024), WithBaseAverageBits(16)}
+
+// chunkAll returns the chunks of data without the data.
+func chunkAll(t testing.TB, data []byte) []Chunk {
+	ch := New(bytes.NewReader(data), testPol, WithBoundaries(64*1024, 1024*1024), WithAverageBits(16))
+
+	var chunks []Chunk
+	for {
+		c, err := ch.Next(nil)
+		if err == io.EOF {
+			return chunks
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.Data = nil
+		chunks = append(chunks, c)
+	}
+}
+
+func testRechunk(t *testing.T, data []byte, old []Chunk, changed []Range) uint {
+	rd := &countingReaderAt{rd: bytes.NewReader(data)}
+	chunks, err := Rechunk(rd, uint(len(data)), old, changed, testPol, rechunkOpts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := chunkAll(t, data)
+	if len(chunks) != len(want) {
+		t.Fatalf("wrong number of chunks: want %d, got %d", len(want), len(chunks))
+	}
+
+	for i := range want {
+		c, w := chunks[i], want[i]
+		if c.Start != w.Start || c.Length != w.Length || c.Cut != w.Cut || c.Data != nil {
+			t.Fatalf("chunk %d: want %+v, got %+v", i, want[i], chunks[i])
+		}
+	}
+
+	return rd.n
+}
+
+func TestRechunk(t *testing.T) {
+	data := getRandom(23, 16*1024*1024)
+	old := chunkAll(t, data)
+	rnd := rand.New(rand.NewSource(5))
+
+	// no changes, nothing needs to be read
+	if n := testRechunk(t, data, old, nil); n != 0 {
+		t.Fatalf("%d bytes read for unchanged data", n)
+	}
+
+	for i := 0; i < 20; i++ {
+		modified := append([]byte(nil), data...)
+		var changed []Range
+		for j := 0; j < 1+rnd.Intn(5); j++ {
+			r := Range{Offset: uint(rnd.Intn(len(data))), Length: uint(1 + rnd.Intn(100*1024))}
+			if r.Offset+r.Length > uint(len(data)) {
+				r.Length = uint(len(data)) - r.Offset
+			}
+
+			rnd.Read(modified[r.Offset : r.Offset+r.Length])
+			changed = append(changed, r)
+		}
+
+		n := testRechunk(t, modified, old, changed)
+		if n >= uint(len(data))/2 {
+			t.Errorf("too many bytes read for %d changed ranges: %d", len(changed), n)
+		}
+	}
+}
+
+func TestRechunkSize(t *testing.T) {
+	data := getRandom(23, 8*1024*1024)
+	old := chunkAll(t, data)
+
+	// truncated
+	for _, size := range []int{0, 1, 100, 3*1024*1024 + 17, len(data) - 1} {
+		testRechunk(t, data[:size], old, nil)
+	}
+
+	// appended data
+	longer := append(append([]byte(nil), data...), getRandom(5, 1024*1024)...)
+	testRechunk(t, longer, old, nil)
+
+	// changed at the start and at the end
+	modified := append([]byte(nil), data...)
+	modified[0] ^= 0xff
+	modified[len(modified)-1] ^= 0xff
+	testRechunk(t, modified, old, []Range{{0, 1}, {uint(len(modified) - 1), 1}})
+
+	// no previous chunks
+	testRechunk(t, data, nil, nil)
+}
+
+func TestRechunkInvalid(t *testing.T) {
+	old := []Chunk{{Start: 0, Length: 10}, {Start: 20, Length: 10}}
+	_, err := Rechunk(bytes.NewReader(make([]byte, 30)), 30, old, nil, testPol)
+	if err == nil {
+		t.Fatal("expected error for non-contiguous chunks")
+	}
+
+	_, err = Rechunk(bytes.NewReader(make([]byte, 10)), 30, nil, nil, testPol)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("wrong error for short reader: %v", err)
+	}
+}
+
+func TestMergeRanges(t *testing.T) {
+	ranges := mergeRanges([]Range{{50, 10}, {0, 0}, {10, 5}, {12, 10}, {22, 3}, {55, 2}})
+	want := []Range{{10, 15}, {50, 10}}
+	if len(ranges) != len(want) {
+		t.Fatalf("wrong ranges returned: %v", ranges)
+	}
+
+	for i := range want {
+		if ranges[i] != want[i] {
+			t.Fatalf("wrong ranges returned: %v", ranges)
+		}
+	}
+}
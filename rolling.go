@@ -0,0 +1,69 @@
+package chunker
+
+// RollingHash computes the Rabin fingerprint of a sliding window over the
+// bytes written to it. The digest is the fingerprint (see Fingerprint) of
+// the last window bytes, or of all bytes if fewer have been written.
+type RollingHash struct {
+	tab    *tables
+	shift  uint
+	window []byte
+	wpos   int
+	digest uint64
+}
+
+// NewRollingHash returns a new RollingHash for polynomial pol and the given
+// window size in bytes. The degree of pol must be between 8 and 53. The
+// tables are shared with all chunkers and hashes using the same polynomial
+// and window size.
+func NewRollingHash(pol Pol, window int) *RollingHash {
+	if window < 1 {
+		panic("window size must be positive")
+	}
+
+	return &RollingHash{
+		tab:    windowTables(pol, window),
+		shift:  uint(pol.Deg() - 8),
+		window: make([]byte, window),
+	}
+}
+
+// Roll slides the window by one byte, adding b.
+func (r *RollingHash) Roll(b byte) {
+	out := r.window[r.wpos]
+	r.window[r.wpos] = b
+	r.wpos++
+	if r.wpos == len(r.window) {
+		r.wpos = 0
+	}
+
+	r.digest ^= uint64(r.tab.out[out])
+	r.digest = updateDigest(r.digest, r.shift, r.tab, b)
+}
+
+// Write slides the window over all bytes in p, it never returns an error.
+func (r *RollingHash) Write(p []byte) (int, error) {
+	for _, b := range p {
+		r.Roll(b)
+	}
+
+	return len(p), nil
+}
+
+// Digest returns the fingerprint of the current window.
+func (r *RollingHash) Digest() uint64 {
+	return r.digest
+}
+
+// Reset clears the window and the digest.
+func (r *RollingHash) Reset() {
+	for i := range r.window {
+		r.window[i] = 0
+	}
+	r.wpos = 0
+	r.digest = 0
+}
+
+// WindowSize returns the size of the window in bytes.
+func (r *RollingHash) WindowSize() int {
+	return len(r.window)
+}
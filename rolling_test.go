@@ -0,0 +1,103 @@
+package chunker
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRollingHash(t *testing.T) {
+	data := getRandom(23, 20000)
+
+	for _, window := range []int{1, 16, 64, 1000} {
+		r := NewRollingHash(testPol, window)
+		if r.WindowSize() != window {
+			t.Fatalf("wrong window size %d", r.WindowSize())
+		}
+
+		for i, b := range data {
+			r.Roll(b)
+
+			start := i + 1 - window
+			if start < 0 {
+				start = 0
+			}
+
+			want := Fingerprint(testPol, data[start:i+1])
+			if Pol(r.Digest()) != want {
+				t.Fatalf("window %d, position %d: wrong digest, want %v, got %v",
+					window, i, want, Pol(r.Digest()))
+			}
+		}
+
+		r.Reset()
+		if r.Digest() != 0 {
+			t.Fatalf("Reset() did not clear the digest")
+		}
+
+		_, err := r.Write(data[:5000])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := Fingerprint(testPol, data[5000-window:5000])
+		if Pol(r.Digest()) != want {
+			t.Fatalf("window %d: wrong digest after Write, want %v, got %v", window, want, Pol(r.Digest()))
+		}
+	}
+}
+
+func TestRollingHashChunkerCut(t *testing.T) {
+	// the cut fingerprint of the chunker is the digest of the last 64 bytes
+	// of a chunk
+	buf := getRandom(23, 32*1024*1024)
+	ch := New(bytes.NewReader(buf), testPol)
+	chunks := testWithData(t, ch, chunks1, false)
+
+	r := NewRollingHash(testPol, windowSize)
+	for i, c := range chunks[:len(chunks)-1] {
+		end := c.Start + c.Length
+		r.Reset()
+		_, _ = r.Write(buf[end-windowSize : end])
+		if r.Digest() != c.Cut {
+			t.Fatalf("chunk %d: wrong digest, want %016x, got %016x", i, c.Cut, r.Digest())
+		}
+	}
+}
+
+func TestRollingHashTableCache(t *testing.T) {
+	data := getRandom(23, 4000)
+	first := NewRollingHash(testPol, 3)
+
+	// the cache does not grow beyond its limit
+	for window := 1; window <= 2*maxCachedTables; window++ {
+		NewRollingHash(testPol, window)
+	}
+
+	cache.Lock()
+	n, m := len(cache.entries), len(cache.order)
+	cache.Unlock()
+	if n > maxCachedTables || n != m {
+		t.Fatalf("%d tables cached, %d in order, want at most %d", n, m, maxCachedTables)
+	}
+
+	// hashes using dropped tables keep working, and the tables are computed
+	// again when needed
+	for _, r := range []*RollingHash{first, NewRollingHash(testPol, 3)} {
+		r.Reset()
+		_, _ = r.Write(data)
+		if want := Fingerprint(testPol, data[len(data)-3:]); Pol(r.Digest()) != want {
+			t.Fatalf("wrong digest, want %v, got %v", want, Pol(r.Digest()))
+		}
+	}
+}
+
+func BenchmarkRollingHash(b *testing.B) {
+	data := getRandom(23, 1024*1024)
+	r := NewRollingHash(testPol, windowSize)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, _ = r.Write(data)
+	}
+}
@@ -0,0 +1,191 @@
+package chunker
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// repeatState tracks whether the data of a chunk consists of a single
+// repeated byte, the zero value describes an empty chunk.
+type repeatState struct {
+	seen  bool // at least one byte has been seen
+	mixed bool // a byte different from b has been seen
+	b     byte
+}
+
+func (s *repeatState) update(data []byte) {
+	if s.mixed || len(data) == 0 {
+		return
+	}
+
+	if !s.seen {
+		s.seen = true
+		s.b = data[0]
+	}
+
+	if runLength(data, s.b) < len(data) {
+		s.mixed = true
+	}
+}
+
+func (s repeatState) repeated() bool {
+	return s.seen && !s.mixed
+}
+
+// LastChunkRepeated returns true if the chunk ended by the last split point
+// returned by NextSplitPoint consists of a single repeated byte. This is only
+// tracked if WithBaseRepeatRuns is used.
+func (c *BaseChunker) LastChunkRepeated() bool {
+	return c.lastRepeated
+}
+
+// endRepeat records whether the chunk which ended with data consists of a
+// single repeated byte, repeat is the state before data.
+func (c *BaseChunker) endRepeat(repeat repeatState, data []byte) {
+	if !c.runs {
+		return
+	}
+
+	repeat.update(data)
+	c.lastRepeated = repeat.repeated()
+}
+
+// nextRunSplitPoint works like nextSplitPoint, but skips the table work for
+// runs of a repeated byte: once the window is filled with the byte, the digest
+// does not change until the run ends. Unless the digest matches, there is no
+// cut within the run before the chunk reaches MaxSize.
+func (c *BaseChunker) nextRunSplitPoint(buf []byte) (int, uint64) {
+	idx := 0
+	for idx < len(buf) {
+		rest := buf[idx:]
+		if n := c.skipRun(rest); n > 0 {
+			idx += n
+			continue
+		}
+
+		// process the data up to the first window of the next run, the bytes
+		// dismissed at the start of a chunk are skipped anyway
+		var pre int
+		if c.pre > 0 && !c.seeking {
+			pre = len(rest)
+			if c.pre < uint(pre) {
+				pre = int(c.pre)
+			}
+		}
+
+		end := pre + findRun(rest[pre:]) + windowSize
+		if end > len(rest) {
+			end = len(rest)
+		}
+
+		split, cut := c.nextSplitPoint(rest[:end])
+		if split != -1 {
+			return idx + split, cut
+		}
+		idx += end
+	}
+
+	return -1, 0
+}
+
+// skipRun skips the bytes at the start of buf which continue the run of
+// bytes in the window without changing the digest, and returns their number.
+func (c *BaseChunker) skipRun(buf []byte) int {
+	if len(buf) == 0 || c.pre > 0 || c.seeking || c.digest&c.splitmask == 0 {
+		return 0
+	}
+
+	b := buf[0]
+	if runLength(c.window[:], b) < windowSize {
+		return 0
+	}
+
+	// the byte which reaches MaxSize is left to nextSplitPoint
+	n := runLength(buf, b)
+	if limit := c.MaxSize - c.count - 1; uint(n) > limit {
+		n = int(limit)
+	}
+
+	c.count += uint(n)
+	c.wpos = (c.wpos + uint(n)) % windowSize
+	return n
+}
+
+// repeatWord contains b in all bytes.
+func repeatWord(b byte) uint64 {
+	return uint64(b) * 0x0101010101010101
+}
+
+// runLength returns the number of bytes at the start of buf which are equal
+// to b.
+func runLength(buf []byte, b byte) int {
+	w := repeatWord(b)
+	n := 0
+	for n+32 <= len(buf) {
+		p := buf[n : n+32]
+		if (binary.LittleEndian.Uint64(p)^w)|(binary.LittleEndian.Uint64(p[8:])^w)|
+			(binary.LittleEndian.Uint64(p[16:])^w)|(binary.LittleEndian.Uint64(p[24:])^w) != 0 {
+			break
+		}
+		n += 32
+	}
+
+	for n+8 <= len(buf) && binary.LittleEndian.Uint64(buf[n:]) == w {
+		n += 8
+	}
+
+	for n < len(buf) && buf[n] == b {
+		n++
+	}
+
+	return n
+}
+
+// findRun returns the index of the first run of at least windowSize equal
+// bytes in buf, or len(buf) if there is none. Such a run contains an aligned
+// word of equal bytes, so only these need to be checked.
+func findRun(buf []byte) int {
+	for i := 0; i+8 <= len(buf); i += 8 {
+		// all bytes of a word are equal if it is equal to its rotation
+		w := binary.LittleEndian.Uint64(buf[i:])
+		if w != bits.RotateLeft64(w, 8) {
+			continue
+		}
+
+		b := buf[i]
+
+		start := i
+		for start > 0 && buf[start-1] == b {
+			start--
+		}
+
+		end := i + runLength(buf[i:], b)
+		if end-start >= windowSize {
+			return start
+		}
+
+		// continue with the word containing the end of the run
+		i = end&^7 - 8
+	}
+
+	return len(buf)
+}
+
+// lastFlags returns the flags for the chunk ended by the last split point.
+func (c *BaseChunker) lastFlags() ChunkFlags {
+	if c.lastRepeated {
+		return ChunkRepeated
+	}
+
+	return 0
+}
+
+// pendingFlags returns the flags for the pending data when it is returned as
+// a chunk without a split point.
+func (c *BaseChunker) pendingFlags() ChunkFlags {
+	if c.runs && c.repeat.repeated() {
+		return ChunkRepeated
+	}
+
+	return 0
+}
@@ -0,0 +1,276 @@
+package chunker
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// runData returns random data interspersed with runs of repeated bytes.
+func runData(seed int64, size int) []byte {
+	rnd := rand.New(rand.NewSource(seed))
+	buf := make([]byte, size)
+	rnd.Read(buf)
+
+	for pos := rnd.Intn(64 * 1024); pos < size; pos += rnd.Intn(512 * 1024) {
+		n := rnd.Intn(2 * 1024 * 1024)
+		if rnd.Intn(4) == 0 {
+			n = rnd.Intn(200)
+		}
+
+		if pos+n > size {
+			n = size - pos
+		}
+
+		var b byte
+		switch rnd.Intn(3) {
+		case 1:
+			b = 0xff
+		case 2:
+			b = byte(rnd.Intn(256))
+		}
+
+		for i := pos; i < pos+n; i++ {
+			buf[i] = b
+		}
+		pos += n
+	}
+
+	return buf
+}
+
+// isRepeated returns true if data consists of a single repeated byte.
+func isRepeated(data []byte) bool {
+	return len(data) > 0 && runLength(data, data[0]) == len(data)
+}
+
+func TestChunkerRepeatRuns(t *testing.T) {
+	data := runData(5, 24*1024*1024)
+	data = append(data, make([]byte, 10*1024*1024)...)
+
+	for i, opts := range [][]option{
+		nil,
+		{WithBoundaries(4*1024, 64*1024), WithAverageBits(13)},
+		{WithBoundaries(4*1024, 64*1024), WithAverageBits(1)},
+		{WithBoundaries(4*1024, 64*1024), WithAverageBits(2), WithBuffer(make([]byte, 1000))},
+		{WithBoundaries(64, 1000), WithAverageBits(4), WithBuffer(make([]byte, 100))},
+		{WithBoundaries(4*1024, 64*1024), WithAverageBits(13), WithAlignment(4096)},
+		{WithBoundaries(4*1024, 64*1024), WithAverageBits(2), WithHybridAlignment(512)},
+		{WithBoundaries(4*1024, 64*1024), WithAverageBits(13), WithDelimiter([]byte{0, 0}, 1000)},
+		{WithBoundaries(4*1024, 64*1024), WithAverageBits(1), WithDelimiter([]byte{0xff}, 100)},
+	} {
+		want := standaloneChunks(t, data, opts...)
+		chunks := standaloneChunks(t, data, append(opts, WithRepeatRuns())...)
+
+		if len(chunks) != len(want) {
+			t.Fatalf("options %d: wrong number of chunks: want %d, got %d", i, len(want), len(chunks))
+		}
+
+		repeated := 0
+		for j, c := range chunks {
+			w := want[j]
+			if c.Start != w.Start || c.Length != w.Length || c.Cut != w.Cut || !bytes.Equal(c.Data, w.Data) {
+				t.Fatalf("options %d: wrong chunk %d: want %d/%d/%016x, got %d/%d/%016x",
+					i, j, w.Start, w.Length, w.Cut, c.Start, c.Length, c.Cut)
+			}
+
+			if w.Flags&ChunkRepeated != 0 {
+				t.Fatalf("options %d: chunk %d flagged without WithRepeatRuns", i, j)
+			}
+
+			if (c.Flags&ChunkRepeated != 0) != isRepeated(c.Data) {
+				t.Fatalf("options %d: wrong flags %v for chunk %d", i, c.Flags, j)
+			}
+
+			if c.Flags&ChunkRepeated != 0 {
+				repeated++
+			}
+		}
+
+		if repeated == 0 {
+			t.Errorf("options %d: no chunk consists of a repeated byte", i)
+		}
+	}
+}
+
+func TestChunkerRepeatRunsFixed(t *testing.T) {
+	data := make([]byte, 10*1000+50)
+	data[5555] = 1
+
+	ch := NewFixed(bytes.NewReader(data), 1000, WithRepeatRuns(), WithFixedTail(TailMerge))
+	chunks := standaloneChunksFrom(t, ch)
+	if len(chunks) != 10 {
+		t.Fatalf("wrong number of chunks: %d", len(chunks))
+	}
+
+	for i, c := range chunks {
+		if (c.Flags == ChunkRepeated) != (i != 5) {
+			t.Fatalf("wrong flags %v for chunk %d", c.Flags, i)
+		}
+	}
+}
+
+func TestBaseChunkerRepeatRuns(t *testing.T) {
+	data := runData(7, 16*1024*1024)
+	opts := []baseOption{WithBaseBoundaries(4*1024, 64*1024), WithBaseAverageBits(13)}
+	want := NewBase(testPol, opts...)
+	c := NewBase(testPol, append(opts, WithBaseRepeatRuns())...)
+
+	for pos := 0; pos < len(data); {
+		wantSplit, wantCut := want.NextSplitPoint(data[pos:])
+		split, cut := c.NextSplitPoint(data[pos:])
+		if split != wantSplit || cut != wantCut {
+			t.Fatalf("wrong split point at %d: want %d/%016x, got %d/%016x", pos, wantSplit, wantCut, split, cut)
+		}
+
+		if split == -1 {
+			break
+		}
+
+		if c.LastChunkRepeated() != isRepeated(data[pos:pos+split]) || want.LastChunkRepeated() {
+			t.Fatalf("wrong result of LastChunkRepeated for the chunk at %d", pos)
+		}
+		pos += split
+	}
+}
+
+func TestFindRun(t *testing.T) {
+	rnd := rand.New(rand.NewSource(3))
+	for i := 0; i < 1000; i++ {
+		buf := make([]byte, rnd.Intn(300))
+		rnd.Read(buf)
+		for j := 0; j < rnd.Intn(4); j++ {
+			pos, n := rnd.Intn(len(buf)+1), rnd.Intn(100)
+			if pos+n > len(buf) {
+				n = len(buf) - pos
+			}
+
+			b := byte(rnd.Intn(2))
+			for k := pos; k < pos+n; k++ {
+				buf[k] = b
+			}
+		}
+
+		want := len(buf)
+		for j := 0; j+windowSize <= len(buf); j++ {
+			if runLength(buf[j:], buf[j]) >= windowSize {
+				want = j
+				break
+			}
+		}
+
+		if n := findRun(buf); n != want {
+			t.Fatalf("wrong run found in %x: want %d, got %d", buf, want, n)
+		}
+	}
+}
+
+// sparseFile returns a file which contains data, the zeros in data are
+// written as holes if the file system supports it.
+func sparseFile(t *testing.T, data []byte) *os.File {
+	f, err := ioutil.TempFile("", "chunker-sparse-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Truncate(int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+
+	const block = 64 * 1024
+	for pos := 0; pos < len(data); pos += block {
+		end := pos + block
+		if end > len(data) {
+			end = len(data)
+		}
+
+		if runLength(data[pos:end], 0) == end-pos {
+			continue
+		}
+
+		if _, err := f.WriteAt(data[pos:end], int64(pos)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return f
+}
+
+func TestChunkerSparse(t *testing.T) {
+	for _, data := range [][]byte{
+		runData(9, 16*1024*1024),
+		append(make([]byte, 3*1024*1024), getRandom(23, 5*1024*1024)...),
+		append(getRandom(23, 5*1024*1024), make([]byte, 3*1024*1024)...),
+		make([]byte, 1024*1024),
+		nil,
+	} {
+		f := sparseFile(t, data)
+		defer f.Close()
+
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+
+		want := standaloneChunks(t, data)
+		chunks := standaloneChunksFrom(t, New(f, testPol, WithSparse(), WithBuffer(make([]byte, 100*1000))))
+		if len(chunks) != len(want) {
+			t.Fatalf("wrong number of chunks: want %d, got %d", len(want), len(chunks))
+		}
+
+		for i, c := range chunks {
+			w := want[i]
+			if c.Start != w.Start || c.Length != w.Length || c.Cut != w.Cut || !bytes.Equal(c.Data, w.Data) {
+				t.Fatalf("wrong chunk %d: want %d/%d/%016x, got %d/%d/%016x",
+					i, w.Start, w.Length, w.Cut, c.Start, c.Length, c.Cut)
+			}
+		}
+	}
+}
+
+func benchmarkRepeatRuns(b *testing.B, data []byte, opts ...option) {
+	buf := make([]byte, MaxSize)
+
+	b.ResetTimer()
+	b.SetBytes(int64(len(data)))
+
+	for i := 0; i < b.N; i++ {
+		ch := New(bytes.NewReader(data), testPol, opts...)
+		for {
+			_, err := ch.Next(buf)
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkChunkerZeros(b *testing.B) {
+	benchmarkRepeatRuns(b, make([]byte, 32*1024*1024))
+}
+
+func BenchmarkChunkerZerosRepeatRuns(b *testing.B) {
+	benchmarkRepeatRuns(b, make([]byte, 32*1024*1024), WithRepeatRuns())
+}
+
+func BenchmarkChunkerRepeatRuns(b *testing.B) {
+	benchmarkRepeatRuns(b, getRandom(23, 32*1024*1024), WithRepeatRuns())
+}
+
+func BenchmarkChunkerRepeated(b *testing.B) {
+	benchmarkRepeatRuns(b, bytes.Repeat([]byte{0xff}, 32*1024*1024))
+}
+
+func BenchmarkChunkerRepeatedRepeatRuns(b *testing.B) {
+	benchmarkRepeatRuns(b, bytes.Repeat([]byte{0xff}, 32*1024*1024), WithRepeatRuns())
+}
@@ -0,0 +1,163 @@
+package chunker
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+// whence values for lseek(2) on Linux
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// sparseReader reads a file and returns its holes as zeros without reading
+// them. It relies on the file offset not being changed by others.
+type sparseReader struct {
+	f   extentFile
+	pos int64
+
+	// the extent containing pos ends at next, it is a hole if hole is set
+	next int64
+	hole bool
+
+	// the file does not support SEEK_DATA and SEEK_HOLE
+	failed bool
+}
+
+// newSparseReader returns a reader which skips the holes of rd if it is a
+// file.
+func newSparseReader(rd io.Reader) io.Reader {
+	f, ok := rd.(*os.File)
+	if !ok {
+		return rd
+	}
+
+	sr, err := newFileSparseReader(f)
+	if err != nil {
+		return rd
+	}
+
+	return sr
+}
+
+// extentFile is the part of *os.File used by sparseReader.
+type extentFile interface {
+	io.ReadSeeker
+	Stat() (os.FileInfo, error)
+	SetReadDeadline(t time.Time) error
+}
+
+// newFileSparseReader returns a sparseReader for f which starts at the
+// current offset.
+func newFileSparseReader(f extentFile) (*sparseReader, error) {
+	pos, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sparseReader{f: f, pos: pos, next: pos}, nil
+}
+
+func (r *sparseReader) Read(p []byte) (int, error) {
+	if r.failed {
+		return r.f.Read(p)
+	}
+
+	if r.pos >= r.next {
+		if err := r.findExtent(); err != nil {
+			// fall back to reading all data
+			r.failed = true
+			if _, err := r.f.Seek(r.pos, io.SeekStart); err != nil {
+				return 0, err
+			}
+
+			return r.f.Read(p)
+		}
+	}
+
+	if r.next > r.pos && int64(len(p)) > r.next-r.pos {
+		p = p[:r.next-r.pos]
+	}
+
+	if !r.hole {
+		n, err := r.f.Read(p)
+		r.pos += int64(n)
+		return n, err
+	}
+
+	for i := range p {
+		p[i] = 0
+	}
+
+	r.pos += int64(len(p))
+
+	// continue reading the file after the hole
+	if r.pos == r.next {
+		if _, err := r.f.Seek(r.pos, io.SeekStart); err != nil {
+			return len(p), err
+		}
+	}
+
+	return len(p), nil
+}
+
+// findExtent finds the data or hole extent starting at pos.
+func (r *sparseReader) findExtent() error {
+	data, err := r.f.Seek(r.pos, seekData)
+	if isErrno(err, syscall.ENXIO) {
+		// no data after pos, the file ends with a hole or pos is at the end
+		fi, err := r.f.Stat()
+		if err != nil {
+			return err
+		}
+
+		if fi.Size() <= r.pos {
+			// read normally, e.g. to return io.EOF or data appended later
+			r.hole = false
+			r.next = r.pos
+			_, err = r.f.Seek(r.pos, io.SeekStart)
+			return err
+		}
+
+		r.hole = true
+		r.next = fi.Size()
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if data > r.pos {
+		r.hole = true
+		r.next = data
+		return nil
+	}
+
+	hole, err := r.f.Seek(r.pos, seekHole)
+	if err != nil {
+		return err
+	}
+
+	r.hole = false
+	r.next = hole
+	_, err = r.f.Seek(r.pos, io.SeekStart)
+	return err
+}
+
+// SetReadDeadline sets the read deadline of the file, see NextContext.
+func (r *sparseReader) SetReadDeadline(t time.Time) error {
+	return r.f.SetReadDeadline(t)
+}
+
+// isErrno returns true if err was caused by the system call error errno.
+func isErrno(err error, errno syscall.Errno) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+
+	return err == errno
+}
@@ -0,0 +1,58 @@
+package chunker
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSparseReader(t *testing.T) {
+	data := append(make([]byte, 4*1024*1024), getRandom(23, 1024*1024)...)
+	data = append(data, make([]byte, 3*1024*1024)...)
+	copy(data[1024*1024:], "foobar")
+
+	f := sparseFile(t, data)
+	defer f.Close()
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	cf := &countingFile{File: f}
+	rd, err := newFileSparseReader(cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := ioutil.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf, data) {
+		t.Fatal("wrong data returned")
+	}
+
+	if rd.failed || cf.n == int64(len(data)) {
+		t.Skip("file system does not support holes")
+	}
+
+	// only the extents containing data are read
+	if cf.n > 2*1024*1024 {
+		t.Fatalf("%d of %d bytes read from the file", cf.n, len(data))
+	}
+}
+
+// countingFile counts the bytes read from the file.
+type countingFile struct {
+	*os.File
+	n int64
+}
+
+func (f *countingFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,65 @@
+package chunker
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// errFlush is returned by readStream when the maximum latency for the
+// pending data has been reached.
+var errFlush = errors.New("maximum latency reached")
+
+// readResult is the result of a read in streaming mode.
+type readResult struct {
+	n   int
+	err error
+}
+
+// readStream reads once from the reader into the buffer. If a maximum latency
+// is set or ctx is not nil, the read is done in a separate goroutine, so the
+// pending data can be flushed (errFlush is returned) or ctx.Err() can be
+// returned while the read blocks. The next call then waits for the pending
+// read.
+func (c *Chunker) readStream(ctx context.Context) (int, error) {
+	if c.maxLatency == 0 && ctx == nil && !c.reading {
+		n, err := c.rd.Read(c.buf)
+		return n, err
+	}
+
+	if !c.reading {
+		if c.result == nil {
+			c.result = make(chan readResult, 1)
+		}
+
+		c.reading = true
+		rd, buf, result := c.rd, c.buf, c.result
+		go func() {
+			n, err := rd.Read(buf)
+			result <- readResult{n, err}
+		}()
+	}
+
+	var timeout <-chan time.Time
+	if c.maxLatency > 0 && !c.chunkSince.IsZero() {
+		t := time.NewTimer(time.Until(c.chunkSince.Add(c.maxLatency)))
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+
+	select {
+	case res := <-c.result:
+		c.reading = false
+		c.bufTime = time.Now()
+		return res.n, res.err
+	case <-timeout:
+		return 0, errFlush
+	case <-done:
+		return 0, ctx.Err()
+	}
+}
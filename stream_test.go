@@ -0,0 +1,166 @@
+package chunker
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// pieceReader returns the data in pieces of random size.
+type pieceReader struct {
+	data []byte
+	rnd  *rand.Rand
+}
+
+func (r *pieceReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+
+	n := 1 + r.rnd.Intn(64*1024)
+	if n > len(p) {
+		n = len(p)
+	}
+
+	n = copy(p[:n], r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestChunkerStreaming(t *testing.T) {
+	buf := getRandom(23, 32*1024*1024)
+	rd := &pieceReader{data: buf, rnd: rand.New(rand.NewSource(5))}
+	ch := New(rd, testPol, WithStreaming())
+	testWithData(t, ch, chunks1, true)
+}
+
+// chanReader returns the data sent over a channel and io.EOF after the channel
+// is closed.
+type chanReader struct {
+	ch  chan []byte
+	buf []byte
+}
+
+func (r *chanReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		buf, ok := <-r.ch
+		if !ok {
+			return 0, io.EOF
+		}
+		r.buf = buf
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func TestChunkerMaxLatency(t *testing.T) {
+	buf := getRandom(23, 8*1024*1024)
+	head := 100 * 1024
+
+	rd := &chanReader{ch: make(chan []byte)}
+	latency := 20 * time.Millisecond
+	ch := New(rd, testPol, WithMaxLatency(latency))
+
+	go func() {
+		rd.ch <- buf[:head]
+	}()
+
+	// the first chunk is shorter than MinSize and is flushed
+	start := time.Now()
+	c, err := ch.Next(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := time.Since(start); d < latency {
+		t.Errorf("chunk flushed after %v, before the maximum latency %v", d, latency)
+	}
+
+	if c.Flags&ChunkFlushed == 0 || c.Start != 0 || !bytes.Equal(c.Data, buf[:head]) {
+		t.Fatalf("wrong chunk returned: start %d, length %d, flags %v", c.Start, c.Length, c.Flags)
+	}
+
+	go func() {
+		for data := buf[head:]; len(data) > 0; {
+			n := 256 * 1024
+			if n > len(data) {
+				n = len(data)
+			}
+			rd.ch <- data[:n]
+			data = data[n:]
+		}
+		close(rd.ch)
+	}()
+
+	// afterwards, the chunks are content-defined again: each chunk which was
+	// not flushed is the same as for a chunker which starts after the last
+	// flushed chunk
+	pos := uint(head)
+	ref := New(bytes.NewReader(buf[pos:]), testPol)
+	refStart := pos
+	for {
+		c, err := ch.Next(nil)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if c.Start != pos || !bytes.Equal(c.Data, buf[pos:pos+c.Length]) {
+			t.Fatalf("wrong chunk at %d: start %d, length %d", pos, c.Start, c.Length)
+		}
+		pos += c.Length
+
+		if c.Flags&ChunkFlushed != 0 {
+			ref = New(bytes.NewReader(buf[pos:]), testPol)
+			refStart = pos
+			continue
+		}
+
+		want, err := ref.Next(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if c.Start != want.Start+refStart || c.Length != want.Length || c.Cut != want.Cut {
+			t.Fatalf("wrong chunk at %d: want %d/%016x, got %d/%016x",
+				c.Start, want.Length, want.Cut, c.Length, c.Cut)
+		}
+	}
+
+	if pos != uint(len(buf)) {
+		t.Fatalf("chunks end at %d, want %d", pos, len(buf))
+	}
+}
+
+func TestChunkerMaxLatencyReset(t *testing.T) {
+	rd := &chanReader{ch: make(chan []byte)}
+	ch := New(rd, testPol, WithMaxLatency(time.Millisecond))
+
+	go func() {
+		rd.ch <- []byte("foobar")
+	}()
+
+	c, err := ch.Next(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Flags != ChunkFlushed || string(c.Data) != "foobar" {
+		t.Fatalf("wrong chunk returned: %q", c.Data)
+	}
+
+	// the read is still pending, Reset must not reuse the buffer
+	buf := ch.buf
+	ch.Reset(bytes.NewReader(nil), testPol)
+	if &ch.buf[0] == &buf[0] {
+		t.Fatal("buffer of the pending read was reused")
+	}
+	close(rd.ch)
+}
@@ -0,0 +1,253 @@
+// Package tarchunk splits tar streams into chunks aligned with the archive
+// entries: the header blocks of each entry are returned as a separate chunk,
+// and the content of each entry is chunked by its own chunker.Chunker, so
+// identical files produce identical chunks regardless of the surrounding
+// entries. Concatenating all chunks in order yields the original tar stream.
+package tarchunk
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/restic/chunker"
+)
+
+// Kind is the type of a Chunk.
+type Kind uint8
+
+const (
+	// KindHeader is a chunk containing the raw header blocks of an entry,
+	// including the padding of the content of the previous entry.
+	KindHeader Kind = iota
+	// KindContent is a content-defined chunk of the content of an entry.
+	KindContent
+	// KindTrailer is the last chunk, it contains the padding of the last
+	// entry, the end-of-archive blocks and all data after them.
+	KindTrailer
+)
+
+// Chunk is a chunk of a tar stream. Start is the offset of the chunk in the
+// tar stream, Entry is the index of the entry the chunk belongs to (-1 for the
+// trailer).
+type Chunk struct {
+	chunker.Chunk
+	Kind  Kind
+	Entry int
+}
+
+// Entry describes an entry of the tar stream.
+type Entry struct {
+	Header *tar.Header
+
+	// Offset is the offset of the content in the tar stream.
+	Offset uint
+
+	// Chunks contains the header chunk and the content chunks of the entry,
+	// without the data.
+	Chunks []Chunk
+}
+
+// Chunker splits a tar stream into chunks.
+type Chunker struct {
+	rd         *recorder
+	tr         *tar.Reader
+	newChunker func(io.Reader) *chunker.Chunker
+
+	entries []Entry
+	content *chunker.Chunker
+	size    uint
+	done    bool
+}
+
+// New returns a Chunker which splits the tar stream read from rd. For each
+// entry with content, newChunker is called to create a chunker.Chunker for the
+// content. Since the previous chunker is not used afterwards, newChunker may
+// pass the same buffer to all chunkers with chunker.WithBuffer.
+func New(rd io.Reader, newChunker func(io.Reader) *chunker.Chunker) *Chunker {
+	rec := &recorder{rd: rd}
+	return &Chunker{
+		rd:         rec,
+		tr:         tar.NewReader(rec),
+		newChunker: newChunker,
+	}
+}
+
+// Entries returns the entries of the tar stream read so far.
+func (c *Chunker) Entries() []Entry {
+	return c.entries
+}
+
+// isSparse returns true if the content of the entry is stored in the sparse
+// format, which is not returned verbatim by tar.Reader.
+func isSparse(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+
+	for key := range hdr.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasContent returns true if the content of the entry is stored after its
+// header. The size of link, device, directory and fifo entries is not
+// meaningful, tar.Reader returns no content for them.
+func hasContent(hdr *tar.Header) bool {
+	switch hdr.Typeflag {
+	case tar.TypeLink, tar.TypeSymlink, tar.TypeChar, tar.TypeBlock, tar.TypeDir, tar.TypeFifo:
+		return false
+	}
+
+	return hdr.Size > 0 && !isSparse(hdr)
+}
+
+// Next returns the next chunk of the tar stream, the data is stored in buf if
+// it is large enough. When the last chunk has been returned, all subsequent
+// calls yield an io.EOF error.
+func (c *Chunker) Next(buf []byte) (Chunk, error) {
+	for {
+		if c.done {
+			return Chunk{}, io.EOF
+		}
+
+		if c.content == nil {
+			return c.nextHeader(buf)
+		}
+
+		entry := len(c.entries) - 1
+		e := &c.entries[entry]
+
+		chunk, err := c.content.Next(buf)
+		if err == io.EOF {
+			if c.rd.n-e.Offset != c.size {
+				return Chunk{}, errors.New("size of the content does not match the header")
+			}
+
+			c.content = nil
+			continue
+		}
+
+		if err != nil {
+			return Chunk{}, err
+		}
+
+		chunk.Start += e.Offset
+		res := Chunk{Chunk: chunk, Kind: KindContent, Entry: entry}
+		c.addChunk(res)
+
+		return res, nil
+	}
+}
+
+// nextHeader reads the next header and returns the raw data read as a chunk.
+func (c *Chunker) nextHeader(buf []byte) (Chunk, error) {
+	start := c.rd.n
+	c.rd.record(buf[:0])
+	hdr, err := c.tr.Next()
+
+	if err == io.EOF {
+		// the data after the end-of-archive blocks
+		_, err = io.Copy(ioutil.Discard, c.rd)
+		if err != nil {
+			return Chunk{}, err
+		}
+
+		c.done = true
+		data := c.rd.stop()
+		if len(data) == 0 {
+			return Chunk{}, io.EOF
+		}
+
+		return Chunk{
+			Chunk: chunker.Chunk{Start: start, Length: uint(len(data)), Data: data},
+			Kind:  KindTrailer,
+			Entry: -1,
+		}, nil
+	}
+
+	data := c.rd.stop()
+	if err != nil {
+		return Chunk{}, err
+	}
+
+	c.entries = append(c.entries, Entry{Header: hdr, Offset: c.rd.n})
+	res := Chunk{
+		Chunk: chunker.Chunk{Start: start, Length: uint(len(data)), Data: data},
+		Kind:  KindHeader,
+		Entry: len(c.entries) - 1,
+	}
+	c.addChunk(res)
+
+	// the content of sparse files is returned as part of the next header chunk
+	if hasContent(hdr) {
+		c.size = uint(hdr.Size)
+		c.content = c.newChunker(contentReader{c.tr})
+	}
+
+	return res, nil
+}
+
+func (c *Chunker) addChunk(chunk Chunk) {
+	chunk.Data = nil
+	e := &c.entries[chunk.Entry]
+	e.Chunks = append(e.Chunks, chunk)
+}
+
+// ErrTruncated is returned by Next if the tar stream ends within the content
+// of an entry.
+var ErrTruncated = errors.New("tar stream ends within the content of an entry")
+
+// contentReader reads the content of an entry. The io.ErrUnexpectedEOF which
+// tar.Reader returns for truncated content is replaced, so that the chunker
+// does not mistake it for the end of a short read.
+type contentReader struct {
+	rd io.Reader
+}
+
+func (r contentReader) Read(p []byte) (int, error) {
+	n, err := r.rd.Read(p)
+	if err == io.ErrUnexpectedEOF {
+		err = ErrTruncated
+	}
+
+	return n, err
+}
+
+// recorder counts the bytes read and records them if requested.
+type recorder struct {
+	rd        io.Reader
+	n         uint
+	buf       []byte
+	recording bool
+}
+
+func (r *recorder) Read(p []byte) (int, error) {
+	n, err := r.rd.Read(p)
+	r.n += uint(n)
+	if r.recording {
+		r.buf = append(r.buf, p[:n]...)
+	}
+
+	return n, err
+}
+
+// record starts recording the data read into buf.
+func (r *recorder) record(buf []byte) {
+	r.buf = buf
+	r.recording = true
+}
+
+// stop stops recording and returns the data read since record was called.
+func (r *recorder) stop() []byte {
+	r.recording = false
+	buf := r.buf
+	r.buf = nil
+	return buf
+}
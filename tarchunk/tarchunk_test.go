@@ -0,0 +1,245 @@
+package tarchunk
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/restic/chunker"
+)
+
+const testPol = chunker.Pol(0x3DA3358B4DC173)
+
+type file struct {
+	hdr  tar.Header
+	data []byte
+}
+
+func random(seed int64, n int) []byte {
+	buf := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(buf)
+	return buf
+}
+
+func buildTar(t *testing.T, files []file, trailer int) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		hdr := f.hdr
+		hdr.Size = int64(len(f.data))
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tw.Write(f.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Write(make([]byte, trailer))
+	return buf.Bytes()
+}
+
+func newTestChunker(rd io.Reader) *Chunker {
+	buf := make([]byte, 64*1024)
+	return New(rd, func(rd io.Reader) *chunker.Chunker {
+		return chunker.New(rd, testPol, chunker.WithBoundaries(16*1024, 256*1024),
+			chunker.WithAverageBits(15), chunker.WithBuffer(buf))
+	})
+}
+
+func chunkTar(t *testing.T, data []byte) ([]Chunk, []Entry) {
+	c := newTestChunker(bytes.NewReader(data))
+
+	var chunks []Chunk
+	for {
+		chunk, err := c.Next(nil)
+		if err == io.EOF {
+			return chunks, c.Entries()
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		chunks = append(chunks, chunk)
+	}
+}
+
+func testFiles() []file {
+	return []file{
+		{tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755}, nil},
+		{tar.Header{Name: "dir/empty", Typeflag: tar.TypeReg, Mode: 0644}, nil},
+		{tar.Header{Name: "dir/small", Typeflag: tar.TypeReg, Mode: 0644}, []byte("foobar\n")},
+		{tar.Header{Name: "dir/large", Typeflag: tar.TypeReg, Mode: 0644}, random(1, 3*1024*1024+17)},
+		{tar.Header{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "large"}, nil},
+		{tar.Header{Name: "dir/" + strings.Repeat("long", 50), Typeflag: tar.TypeReg, Mode: 0644,
+			PAXRecords: map[string]string{"user.comment": "test"}}, random(2, 700*1024)},
+		{tar.Header{Name: "dir/odd", Typeflag: tar.TypeReg, Mode: 0644}, random(3, 1234)},
+	}
+}
+
+func TestChunker(t *testing.T) {
+	files := testFiles()
+	data := buildTar(t, files, 10240)
+	chunks, entries := chunkTar(t, data)
+
+	// the chunks reconstruct the tar stream
+	var buf []byte
+	for i, c := range chunks {
+		if c.Start != uint(len(buf)) || c.Length != uint(len(c.Data)) {
+			t.Fatalf("chunk %d: wrong start %d or length %d", i, c.Start, c.Length)
+		}
+		buf = append(buf, c.Data...)
+	}
+
+	if !bytes.Equal(buf, data) {
+		t.Fatal("chunks do not reconstruct the tar stream")
+	}
+
+	if last := chunks[len(chunks)-1]; last.Kind != KindTrailer || last.Entry != -1 {
+		t.Fatalf("last chunk is not the trailer: %v", last.Kind)
+	}
+
+	if len(entries) != len(files) {
+		t.Fatalf("wrong number of entries: want %d, got %d", len(files), len(entries))
+	}
+
+	for i, e := range entries {
+		f := files[i]
+		if e.Header.Name != f.hdr.Name {
+			t.Errorf("entry %d: wrong name %q", i, e.Header.Name)
+		}
+
+		if !bytes.Equal(data[e.Offset:e.Offset+uint(len(f.data))], f.data) {
+			t.Errorf("entry %d: wrong offset %d", i, e.Offset)
+		}
+
+		if e.Chunks[0].Kind != KindHeader || e.Chunks[0].Start+e.Chunks[0].Length != e.Offset {
+			t.Errorf("entry %d: wrong header chunk", i)
+		}
+
+		// the content chunks cover the content
+		pos := e.Offset
+		for _, c := range e.Chunks[1:] {
+			if c.Kind != KindContent || c.Start != pos || c.Entry != i || c.Data != nil {
+				t.Fatalf("entry %d: wrong content chunk at %d", i, c.Start)
+			}
+			pos += c.Length
+		}
+
+		if pos != e.Offset+uint(len(f.data)) {
+			t.Errorf("entry %d: content chunks end at %d", i, pos)
+		}
+	}
+}
+
+// contentChunks returns the content chunks of the entry with the given name.
+func contentChunks(t *testing.T, data []byte, name string) [][]byte {
+	chunks, entries := chunkTar(t, data)
+
+	var res [][]byte
+	for _, c := range chunks {
+		if c.Kind == KindContent && entries[c.Entry].Header.Name == name {
+			res = append(res, c.Data)
+		}
+	}
+
+	return res
+}
+
+func TestChunkerIdenticalFiles(t *testing.T) {
+	shared := file{tar.Header{Name: "shared", Typeflag: tar.TypeReg, Mode: 0644}, random(5, 2*1024*1024)}
+
+	a := buildTar(t, []file{
+		{tar.Header{Name: "a", Typeflag: tar.TypeReg, Mode: 0644}, random(6, 100*1024+3)},
+		shared,
+	}, 0)
+
+	b := buildTar(t, []file{
+		{tar.Header{Name: "b1", Typeflag: tar.TypeReg, Mode: 0644}, random(7, 5*1024+1)},
+		{tar.Header{Name: "b2", Typeflag: tar.TypeReg, Mode: 0644}, random(8, 333*1024)},
+		shared,
+	}, 512)
+
+	chunksA := contentChunks(t, a, "shared")
+	chunksB := contentChunks(t, b, "shared")
+	if len(chunksA) < 2 || len(chunksA) != len(chunksB) {
+		t.Fatalf("wrong number of chunks: %d and %d", len(chunksA), len(chunksB))
+	}
+
+	for i := range chunksA {
+		if !bytes.Equal(chunksA[i], chunksB[i]) {
+			t.Fatalf("chunk %d is different", i)
+		}
+	}
+}
+
+func TestChunkerInvalid(t *testing.T) {
+	data := buildTar(t, testFiles(), 0)
+
+	c := newTestChunker(bytes.NewReader(data[:len(data)/2]))
+	for {
+		_, err := c.Next(nil)
+		if err == io.EOF {
+			t.Fatal("no error returned for truncated tar stream")
+		}
+
+		if err != nil {
+			if err != ErrTruncated {
+				t.Fatalf("wrong error for truncated content: %v", err)
+			}
+			break
+		}
+	}
+}
+
+func TestChunkerHeaderOnly(t *testing.T) {
+	// the size of header-only entries is stored, but not their content
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range []tar.Header{
+		{Name: "file", Typeflag: tar.TypeReg, Mode: 0644, Size: 10},
+		{Name: "link", Typeflag: tar.TypeLink, Linkname: "file", Size: 10, Format: tar.FormatPAX},
+		{Name: "dev", Typeflag: tar.TypeChar, Size: 10, Format: tar.FormatPAX},
+	} {
+		hdr := hdr
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte("0123456789")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	chunks, entries := chunkTar(t, buf.Bytes())
+	if len(entries) != 3 {
+		t.Fatalf("wrong number of entries: %d", len(entries))
+	}
+
+	var data []byte
+	for _, c := range chunks {
+		if c.Kind == KindContent && c.Entry != 0 {
+			t.Fatalf("content chunk returned for entry %d", c.Entry)
+		}
+		data = append(data, c.Data...)
+	}
+
+	if !bytes.Equal(data, buf.Bytes()) {
+		t.Fatal("chunks do not match the tar stream")
+	}
+}